@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/metrics"
+	"data-migration/internal/throttle"
+	"encoding/json"
+	"net/http"
+)
+
+// bandwidth limits the migration streams of the run, shared by the databases of --all-databases; nil
+// when --max-bandwidth is not set
+var bandwidth *throttle.Limiter
+
+// bandwidthControl lets the /bandwidth endpoint change the limit, not only read it. The endpoint is not
+// authenticated, so this is opt-in.
+var bandwidthControl bool
+
+// startBandwidthControl creates the limiter of --max-bandwidth and lets it be adjusted while the
+// migration runs: SIGUSR1 halves the limit, SIGUSR2 doubles it, and the /bandwidth endpoint next to
+// the metrics reads it, or sets it with --bandwidth-control. Call it before startMetrics; the returned
+// function stops the signals.
+func startBandwidthControl(cfg *config.Config, logger *config.Logger) (func(), error) {
+	if cfg.MaxBandwidth == "" {
+		return func() {}, nil
+	}
+	rate, err := throttle.ParseRate(cfg.MaxBandwidth)
+	if err != nil {
+		return nil, err
+	}
+
+	bandwidth = throttle.NewLimiter(rate)
+	metrics.BandwidthLimit(rate)
+	metrics.Handle("/bandwidth", bandwidthHandler(bandwidth, bandwidthControl, logger))
+	return notifyBandwidthSignals(bandwidth, logger), nil
+}
+
+// setBandwidth changes the limit and reports it
+func setBandwidth(limiter *throttle.Limiter, rate int64, source string, logger *config.Logger) {
+	limiter.SetRate(rate)
+	metrics.BandwidthLimit(limiter.Rate())
+	logger.Infow("Bandwidth limit changed", "max_bandwidth", throttle.FormatRate(limiter.Rate()), "by", source)
+}
+
+// bandwidthHandler returns the current limit on GET and, when writable, sets it from the rate parameter
+// on POST or PUT, e.g. curl -X POST 'localhost:9090/bandwidth?rate=20MB/s'
+func bandwidthHandler(limiter *throttle.Limiter, writable bool, logger *config.Logger) http.Handler {
+	allow := "GET"
+	if writable {
+		allow = "GET, POST, PUT"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			if !writable {
+				w.Header().Set("Allow", allow)
+				http.Error(w, "changing the limit requires --bandwidth-control", http.StatusMethodNotAllowed)
+				return
+			}
+			rate, err := throttle.ParseRate(r.FormValue("rate"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			setBandwidth(limiter, rate, "endpoint", logger)
+		default:
+			w.Header().Set("Allow", allow)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rate := limiter.Rate()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"max_bandwidth":    throttle.FormatRate(rate),
+			"bytes_per_second": rate,
+		})
+	})
+}
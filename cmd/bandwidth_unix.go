@@ -0,0 +1,51 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/throttle"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ignoreBandwidthSignals keeps SIGUSR1 and SIGUSR2 from terminating commands that do not adjust the
+// limit, as their default action does
+func ignoreBandwidthSignals() {
+	signal.Ignore(syscall.SIGUSR1, syscall.SIGUSR2)
+}
+
+// notifyBandwidthSignals halves the limit on SIGUSR1 and doubles it on SIGUSR2 until the returned
+// function is called. An unlimited stream stays unlimited.
+func notifyBandwidthSignals(limiter *throttle.Limiter, logger *config.Logger) func() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-signalChan:
+				rate := limiter.Rate()
+				if rate == 0 {
+					logger.Warnf("Ignoring %v: the bandwidth is not limited", sig)
+					continue
+				}
+				if sig == syscall.SIGUSR1 {
+					rate /= 2
+				} else {
+					rate *= 2
+				}
+				setBandwidth(limiter, rate, sig.String(), logger)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signalChan)
+		close(done)
+	}
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/throttle"
+)
+
+// ignoreBandwidthSignals does nothing: Windows has no SIGUSR1 and SIGUSR2
+func ignoreBandwidthSignals() {}
+
+// notifyBandwidthSignals does nothing: Windows has no SIGUSR1 and SIGUSR2, use the /bandwidth endpoint
+func notifyBandwidthSignals(*throttle.Limiter, *config.Logger) func() {
+	return func() {}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"fmt"
+	"github.com/spf13/cobra"
+	"sort"
+)
+
+var (
+	configFile    string
+	configProfile string
+
+	// fileSettings records the flags whose value comes from the config file rather than the command line
+	fileSettings = make(map[string]bool)
+)
+
+// loadConfigFile applies the settings of --config to every flag not given on the command line
+func loadConfigFile(cmd *cobra.Command, args []string) error {
+	if configFile == "" {
+		if configProfile != "" {
+			return fmt.Errorf("--profile requires --config")
+		}
+		return nil
+	}
+
+	file, err := config.LoadFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	settings, err := file.Resolve(configProfile)
+	if err != nil {
+		return err
+	}
+
+	return applySettings(cmd, settings)
+}
+
+func applySettings(cmd *cobra.Command, settings map[string][]string) error {
+	// Apply in a stable order so errors are reproducible
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "config" || key == "profile" {
+			return fmt.Errorf("setting %q cannot be used inside a config file", key)
+		}
+
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil {
+			return fmt.Errorf("unknown setting %q in %s", key, configFile)
+		}
+
+		// Flags given on the command line override the file
+		if flag.Changed {
+			continue
+		}
+
+		for _, value := range settings[key] {
+			if err := cmd.Flags().Set(key, value); err != nil {
+				return fmt.Errorf("invalid value %q for setting %q in %s: %w", value, key, configFile, err)
+			}
+		}
+		fileSettings[key] = true
+	}
+
+	return nil
+}
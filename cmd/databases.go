@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"data-migration/internal/notify"
+	"data-migration/internal/tracing"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"slices"
+	"sync"
+	"time"
+)
+
+// databaseResult records the outcome of migrating one database in --all-databases mode
+type databaseResult struct {
+	source   string
+	target   string
+	duration time.Duration
+	err      error
+	outcome  notify.Result
+}
+
+// runAllDatabases migrates every user database found on the source server, recording the
+// per-database outcomes into payload
+func runAllDatabases(ctx context.Context, cfg *config.Config, logger *config.Logger, payload *notify.Payload) error {
+	mapping, err := cfg.DatabaseMapping()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	setupSignalHandler(ctx, cancel, logger)
+
+	logger.Info("Testing source connection...")
+	if err := testConnection(ctx, "source", cfg.SourceType, cfg.SourceConn); err != nil {
+		return fmt.Errorf("source connection (%s) test failed: %w", migration.MaskConnectionString(cfg.SourceConn), err)
+	}
+
+	databases, err := migration.ListDatabases(ctx, cfg.SourceType, cfg.SourceConn)
+	if err != nil {
+		return fmt.Errorf("failed to list source databases: %w", err)
+	}
+	if len(databases) == 0 {
+		logger.Warn("No user databases found on source, nothing to migrate")
+		return nil
+	}
+
+	for src := range mapping {
+		if !slices.Contains(databases, src) {
+			return fmt.Errorf("database %q in --database-map does not exist on source", src)
+		}
+	}
+
+	parallelism := cfg.ParallelDatabases
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	logger.Infof("Found %d databases to migrate (parallelism: %d)", len(databases), parallelism)
+
+	results := make([]databaseResult, len(databases))
+	semaphore := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, name := range databases {
+		target := name
+		if mapped, ok := mapping[name]; ok {
+			target = mapped
+		}
+		results[i] = databaseResult{source: name, target: target}
+
+		wg.Add(1)
+		go func(result *databaseResult) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				result.err = ctx.Err()
+				return
+			}
+
+			start := time.Now()
+			result.err = migrateOneOfMany(ctx, cfg, logger, result.source, result.target, &result.outcome)
+			result.duration = time.Since(start)
+		}(&results[i])
+	}
+
+	wg.Wait()
+
+	outcomes := make([]notify.Result, len(results))
+	for i, result := range results {
+		outcomes[i] = result.outcome
+		if outcomes[i].Source == "" {
+			// Canceled before it started
+			outcomes[i].Source = result.source
+			outcomes[i].Target = result.target
+			outcomes[i].Verification = notify.VerificationSkipped
+		}
+		setStatus(&outcomes[i], result.err)
+	}
+	summarizeDatabases(payload, outcomes)
+
+	return reportDatabaseResults(logger, results)
+}
+
+// migrateOneOfMany migrates a single database of the source server into its target counterpart
+func migrateOneOfMany(ctx context.Context, cfg *config.Config, logger *config.Logger, source, target string, outcome *notify.Result) (err error) {
+	dbLogger := logger.With("database", source)
+
+	ctx, span := tracing.Start(ctx, "database", tracing.DBSystem(cfg.SourceType),
+		attribute.String("db.namespace", source), attribute.String("migrationdb.target_database", target))
+	defer func() { tracing.End(span, err) }()
+
+	sourceConn, err := migration.ReplaceDatabase(cfg.SourceConn, source)
+	if err != nil {
+		return err
+	}
+	targetConn, err := migration.ReplaceDatabase(cfg.TargetConn, target)
+	if err != nil {
+		return err
+	}
+
+	dbCfg := *cfg
+	dbCfg.SourceConn = sourceConn
+	dbCfg.TargetConn = targetConn
+
+	if cfg.DryRun {
+		exists, err := migration.DatabaseExists(ctx, cfg.TargetType, cfg.TargetConn, target)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			// The target cannot be connected to before it is created, so only the source is tested
+			dbLogger.Infof("Database %s does not exist on target and would be created", target)
+			if err := testConnection(ctx, "source", dbCfg.SourceType, dbCfg.SourceConn); err != nil {
+				return fmt.Errorf("source connection (%s) test failed: %w", migration.MaskConnectionString(dbCfg.SourceConn), err)
+			}
+			return dryRun(&dbCfg, dbLogger, true)
+		}
+	} else if err := migration.EnsureDatabase(ctx, cfg.TargetType, cfg.TargetConn, target); err != nil {
+		return err
+	}
+
+	if source != target {
+		dbLogger.Infof("Migrating database %s into %s", source, target)
+	} else {
+		dbLogger.Infof("Migrating database %s", source)
+	}
+
+	return migrateDatabase(ctx, &dbCfg, dbLogger, outcome)
+}
+
+// reportDatabaseResults logs the per-database status and fails if any database failed
+func reportDatabaseResults(logger *config.Logger, results []databaseResult) error {
+	failed := 0
+	logger.Info("Migration summary:")
+	for _, result := range results {
+		name := result.source
+		if result.source != result.target {
+			name = fmt.Sprintf("%s -> %s", result.source, result.target)
+		}
+
+		if result.err != nil {
+			failed++
+			logger.Errorf("  %s: FAILED after %v: %v", name, result.duration.Round(time.Second), result.err)
+		} else {
+			logger.Infof("  %s: OK in %v", name, result.duration.Round(time.Second))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d databases failed to migrate", failed, len(results))
+	}
+
+	logger.Infof("All %d databases migrated successfully!", len(results))
+	return nil
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/metrics"
+	"data-migration/internal/migration"
+	"data-migration/internal/tracing"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Interval between two replication lag log lines while the target keeps up
+const followLogInterval = 30 * time.Second
+
+// newFollower creates the follower of cfg and starts capturing source changes, before the initial load
+func newFollower(ctx context.Context, cfg *config.Config, logger *config.Logger) (migration.Follower, error) {
+	opts := []migration.FollowerOption{migration.WithReplicationSlot(cfg.FollowSlot)}
+	if migration.DatabaseType(cfg.SourceType) == migration.MongoDB {
+		namespaces, err := migration.NamespaceMappingFor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace mapping: %w", err)
+		}
+		opts = append(opts, migration.WithFollowNamespaces(namespaces))
+	}
+
+	follower, err := migration.CreateFollower(cfg.SourceType, cfg.SourceConn, cfg.TargetConn, logger, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	prepareCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := follower.Prepare(prepareCtx); err != nil {
+		follower.Close()
+		return nil, fmt.Errorf("failed to start capturing source changes: %w", err)
+	}
+
+	return follower, nil
+}
+
+// cleanupFollower removes what follower keeps on the source, even once ctx is canceled
+func cleanupFollower(ctx context.Context, follower migration.Follower) error {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	return follower.Cleanup(cleanupCtx)
+}
+
+// follow applies the source changes to the target until the user stops it with SIGINT or SIGTERM,
+// which is the normal way out once the application is ready for cutover
+func follow(ctx context.Context, cfg *config.Config, logger *config.Logger, follower migration.Follower) (err error) {
+	followCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	// Setup signal handling
+	setupSignalHandler(followCtx, cancel, logger)
+
+	defer metrics.StartPhase(metrics.PhaseFollowing)()
+	spanCtx, span := tracing.Start(followCtx, "follow", tracing.DBSystem(cfg.SourceType))
+	defer func() { tracing.End(span, err) }()
+
+	logger.Info("Following source changes, stop with Ctrl+C when ready for cutover")
+
+	reporter := &followReporter{logger: logger}
+	err = follower.Follow(spanCtx, reporter.report)
+	if errors.Is(followCtx.Err(), context.Canceled) {
+		logger.Infow("Stopped following source changes, ready for cutover",
+			"applied", reporter.last.Applied,
+			"position", reporter.last.Position,
+			"caught_up", reporter.last.CaughtUp,
+		)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("following changes failed: %w", err)
+	}
+	return nil
+}
+
+// followReporter logs and records the replication lag reported by a follower
+type followReporter struct {
+	logger  *config.Logger
+	last    migration.FollowStatus
+	logged  time.Time
+	started bool
+}
+
+func (r *followReporter) report(status migration.FollowStatus) {
+	metrics.ReplicationLag(status.Lag)
+	metrics.ChangesApplied(status.Applied - r.last.Applied)
+
+	caughtUp := status.CaughtUp && (!r.started || !r.last.CaughtUp)
+	r.last = status
+	r.started = true
+
+	if caughtUp {
+		r.logger.Infow("Target caught up with the source", "applied", status.Applied, "position", status.Position)
+		r.logged = time.Now()
+		return
+	}
+	if time.Since(r.logged) < followLogInterval {
+		return
+	}
+	r.logged = time.Now()
+
+	fields := []interface{}{
+		"lag", status.Lag.Round(time.Millisecond).String(),
+		"applied", status.Applied,
+		"position", status.Position,
+	}
+	if status.LagBytes >= 0 {
+		fields = append(fields, "lag_bytes", status.LagBytes)
+	}
+	r.logger.Infow("Replication lag", fields...)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"fmt"
+	"os"
+)
+
+// newLogger creates the logger described by the logging flags of c. The returned function
+// flushes the logger and closes the log file.
+func newLogger(c *config.Config) (*config.Logger, func(), error) {
+	opts := config.LoggerOptions{Format: c.LogFormat}
+
+	var file *os.File
+	if c.LogFile != "" {
+		var err error
+		file, err = os.OpenFile(c.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		opts.Output = file
+	}
+
+	logger := config.NewLogger(c.LogLevel, opts)
+
+	return logger, func() {
+		logger.Sync()
+		if file != nil {
+			file.Close()
+		}
+	}, nil
+}
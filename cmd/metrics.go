@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/metrics"
+)
+
+// metricsAddr is the listen address of the Prometheus metrics endpoint, disabled when empty
+var metricsAddr string
+
+// startMetrics serves the metrics endpoint when --metrics-addr is set. The returned function stops it.
+func startMetrics(logger *config.Logger) (func(), error) {
+	if metricsAddr == "" {
+		return func() {}, nil
+	}
+
+	stop, err := metrics.Serve(metricsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Serving Prometheus metrics on http://%s/metrics", metricsAddr)
+	return stop, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"data-migration/internal/notify"
+	"errors"
+	"time"
+)
+
+// Time allowed to deliver a notification, retries included
+const notifyTimeout = 2 * time.Minute
+
+// newNotifyPayload starts the notification payload of a run of cfg
+func newNotifyPayload(cfg *config.Config) *notify.Payload {
+	return &notify.Payload{
+		Result: notify.Result{
+			Source:       migration.MaskConnectionString(cfg.SourceConn),
+			Target:       migration.MaskConnectionString(cfg.TargetConn),
+			PhaseSeconds: make(map[string]float64),
+			Verification: notify.VerificationSkipped,
+		},
+		DatabaseType: cfg.SourceType,
+		StartedAt:    time.Now(),
+	}
+}
+
+// notifyCompletion posts the outcome of a run to --notify-url. Delivery failures are logged, they
+// do not change the outcome of the run.
+func notifyCompletion(cfg *config.Config, logger *config.Logger, payload *notify.Payload, err error) {
+	if cfg.NotifyURL == "" || cfg.DryRun {
+		return
+	}
+
+	payload.FinishedAt = time.Now()
+	payload.DurationSeconds = payload.FinishedAt.Sub(payload.StartedAt).Seconds()
+	setStatus(&payload.Result, err)
+
+	notifier := notify.New(cfg.NotifyURL,
+		notify.WithTemplate(cfg.NotifyTemplate),
+		notify.WithRetries(cfg.NotifyRetries),
+		notify.WithLogger(logger),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if err := notifier.Send(ctx, *payload); err != nil {
+		logger.Warnf("Failed to send notification: %v", err)
+		return
+	}
+	logger.Infow("Notification sent", "status", payload.Status)
+}
+
+// setStatus records the status and error of a migration ending with err
+func setStatus(result *notify.Result, err error) {
+	switch {
+	case err == nil:
+		result.Status = notify.StatusSucceeded
+	case errors.Is(err, migration.ErrContentMismatch):
+		result.Status = notify.StatusVerificationFailed
+		result.Error = err.Error()
+	default:
+		result.Status = notify.StatusError
+		result.Error = err.Error()
+	}
+}
+
+// recordStats copies the figures of a migration manager into result
+func recordStats(result *notify.Result, stats migration.Stats) {
+	if result.PhaseSeconds == nil {
+		result.PhaseSeconds = make(map[string]float64)
+	}
+	for name, duration := range stats.Phases {
+		result.PhaseSeconds[name] = duration.Seconds()
+	}
+	result.BytesDumped = stats.BytesDumped
+	result.BytesRestored = stats.BytesRestored
+	result.SourcePosition = stats.SourcePosition.String()
+	result.SourceGTIDSet = stats.SourcePosition.GTIDSet
+}
+
+// summarizeDatabases sets the totals of an --all-databases run from its per-database results
+func summarizeDatabases(payload *notify.Payload, results []notify.Result) {
+	payload.Databases = results
+
+	verification := notify.VerificationSkipped
+	for _, result := range results {
+		for name, seconds := range result.PhaseSeconds {
+			payload.PhaseSeconds[name] += seconds
+		}
+		payload.BytesDumped += result.BytesDumped
+		payload.BytesRestored += result.BytesRestored
+
+		switch {
+		case result.Verification == notify.VerificationFailed:
+			verification = notify.VerificationFailed
+		case result.Verification == notify.VerificationPassed && verification == notify.VerificationSkipped:
+			verification = notify.VerificationPassed
+		}
+	}
+	payload.Verification = verification
+}
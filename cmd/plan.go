@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// dryRun prints the migration plan for a single database without moving any data.
+// createTarget indicates that the target database does not exist yet.
+func dryRun(cfg *config.Config, logger *config.Logger, createTarget bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	setupSignalHandler(ctx, cancel, logger)
+
+	logger.Info("Dry run: introspecting databases, no data will be moved")
+
+	manager := migration.NewManager(cfg, logger)
+	plan, err := manager.Plan(ctx, createTarget)
+	if err != nil {
+		return fmt.Errorf("failed to build migration plan: %w", err)
+	}
+
+	// Render the whole plan before writing so concurrent plans do not interleave
+	var out bytes.Buffer
+	printPlan(&out, cfg, plan)
+	_, err = os.Stdout.Write(out.Bytes())
+	return err
+}
+
+func printPlan(out *bytes.Buffer, cfg *config.Config, plan *migration.Plan) {
+	fmt.Fprintln(out, "\nMigration plan (dry run):")
+	fmt.Fprintf(out, "  Source: %s (%s)\n", migration.MaskConnectionString(cfg.SourceConn), cfg.SourceType)
+	if cfg.StdoutMode {
+		fmt.Fprintln(out, "  Target: stdout")
+	} else {
+		fmt.Fprintf(out, "  Target: %s (%s)\n", migration.MaskConnectionString(cfg.TargetConn), cfg.TargetType)
+	}
+
+	fmt.Fprintln(out, "\nCommands:")
+	fmt.Fprintf(out, "  dump:    %s\n", plan.DumpCommand)
+	if plan.RestoreCommand != "" {
+		fmt.Fprintf(out, "  restore: %s\n", plan.RestoreCommand)
+	}
+
+	fmt.Fprintf(out, "\nObjects to migrate (%d, ~%s):\n", len(plan.Objects), formatBytes(plan.TotalBytes()))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, object := range plan.Objects {
+		name := object.Name
+		if object.Target != "" && object.Target != object.Name {
+			name = fmt.Sprintf("%s -> %s", object.Name, object.Target)
+		}
+		fmt.Fprintf(tw, "  %s\t~%d rows\t%s\n", name, object.Rows, formatBytes(object.Bytes))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(out, "\nVerification:")
+	fmt.Fprintf(out, "  %s\n", plan.Verification)
+
+	if !cfg.StdoutMode {
+		fmt.Fprintln(out, "\nDestructive actions on target:")
+		for _, action := range plan.Destructive {
+			fmt.Fprintf(out, "  - %s\n", action)
+		}
+	}
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bufio"
+	"data-migration/internal/migration"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// promptMu serializes prompts when several databases are migrated concurrently
+var promptMu sync.Mutex
+
+// isInteractive reports whether stdin is attached to a terminal
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmOverwrite asks on the terminal before dropping the content of a non-empty target.
+// Non-interactive runs rely on --overwrite alone.
+func confirmOverwrite(target string) migration.OverwriteConfirmation {
+	return func(info migration.TargetInfo) bool {
+		if !isInteractive() {
+			return true
+		}
+
+		promptMu.Lock()
+		defer promptMu.Unlock()
+
+		fmt.Fprintf(os.Stderr, "Target %s contains %d %s that will be dropped. Continue? [y/N] ",
+			migration.MaskConnectionString(target), info.Objects, info.Kind)
+
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return false
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"data-migration/internal/secrets"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Environment variables holding the source and target passwords
+const (
+	sourcePasswordEnv = "MIGRATIONDB_SOURCE_PASSWORD"
+	targetPasswordEnv = "MIGRATIONDB_TARGET_PASSWORD"
+)
+
+// resolveCredentials injects the passwords found in files, environment variables, secret
+// providers or PostgreSQL password and service files into the connection strings
+func resolveCredentials(cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	resolver, err := newSecretResolver(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.SourceConn, err = resolveConnCredentials(ctx, resolver, cfg.SourceType, cfg.SourceConn,
+		cfg.SourcePasswordFile, cfg.SourcePasswordSecret, sourcePasswordEnv)
+	if err != nil {
+		return fmt.Errorf("source credentials: %w", err)
+	}
+
+	if cfg.StdoutMode {
+		return nil
+	}
+
+	cfg.TargetConn, err = resolveConnCredentials(ctx, resolver, cfg.TargetType, cfg.TargetConn,
+		cfg.TargetPasswordFile, cfg.TargetPasswordSecret, targetPasswordEnv)
+	if err != nil {
+		return fmt.Errorf("target credentials: %w", err)
+	}
+
+	return nil
+}
+
+func newSecretResolver(cfg *config.Config) (*secrets.Resolver, error) {
+	vaultAddr := cfg.VaultAddr
+	if vaultAddr == "" {
+		vaultAddr = os.Getenv("VAULT_ADDR")
+	}
+
+	vaultToken := os.Getenv("VAULT_TOKEN")
+	if cfg.VaultTokenFile != "" {
+		token, err := secrets.FileProvider{}.Resolve(context.Background(), cfg.VaultTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token: %w", err)
+		}
+		vaultToken = token
+	}
+
+	return secrets.NewResolver(
+		secrets.FileProvider{},
+		secrets.EnvProvider{},
+		secrets.NewVaultProvider(vaultAddr, vaultToken, os.Getenv("VAULT_NAMESPACE")),
+	), nil
+}
+
+// resolveConnCredentials returns connString with its password taken, in order of precedence, from
+// the password file, the secret reference, the environment variable, the connection string itself
+// and finally the PostgreSQL password file
+func resolveConnCredentials(ctx context.Context, resolver *secrets.Resolver, dbType, connString, passwordFile, secretRef, envVar string) (string, error) {
+	if passwordFile != "" && secretRef != "" {
+		return "", fmt.Errorf("a password file and a password secret cannot be used together")
+	}
+
+	var err error
+	if migration.DatabaseType(dbType) == migration.Postgres {
+		if connString, err = secrets.ApplyPostgresService(connString); err != nil {
+			return "", err
+		}
+	}
+
+	var password string
+	switch {
+	case passwordFile != "":
+		password, err = resolver.Resolve(ctx, "file:"+passwordFile)
+	case secretRef != "":
+		password, err = resolver.Resolve(ctx, secretRef)
+	default:
+		password = os.Getenv(envVar)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	if password == "" {
+		if u.User == nil || migration.DatabaseType(dbType) != migration.Postgres {
+			return connString, nil
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return connString, nil
+		}
+
+		database, _ := migration.DatabaseName(connString)
+		found, ok, err := secrets.LookupPgpass(u.Hostname(), u.Port(), database, u.User.Username())
+		if err != nil || !ok {
+			return connString, err
+		}
+		password = found
+	}
+
+	if u.User == nil {
+		return "", fmt.Errorf("a password was provided but the connection string has no user")
+	}
+	u.User = url.UserPassword(u.User.Username(), password)
+
+	return u.String(), nil
+}
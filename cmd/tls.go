@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"fmt"
+)
+
+// applyTLSOptions translates the TLS flags into the connection strings, where both the
+// command-line tools and the Go drivers pick them up
+func applyTLSOptions(cfg *config.Config) error {
+	mode := migration.TLSMode(cfg.TLSMode)
+	if cfg.SkipTLSVerify && mode == "" {
+		mode = migration.TLSRequire
+	}
+
+	var err error
+	cfg.SourceConn, err = migration.ApplyTLS(migration.DatabaseType(cfg.SourceType), cfg.SourceConn, migration.TLSOptions{
+		Mode:     mode,
+		CAFile:   cfg.SourceCA,
+		CertFile: cfg.SourceCert,
+		KeyFile:  cfg.SourceKey,
+	})
+	if err != nil {
+		return fmt.Errorf("source TLS settings: %w", err)
+	}
+
+	if cfg.StdoutMode {
+		return nil
+	}
+
+	cfg.TargetConn, err = migration.ApplyTLS(migration.DatabaseType(cfg.TargetType), cfg.TargetConn, migration.TLSOptions{
+		Mode:     mode,
+		CAFile:   cfg.TargetCA,
+		CertFile: cfg.TargetCert,
+		KeyFile:  cfg.TargetKey,
+	})
+	if err != nil {
+		return fmt.Errorf("target TLS settings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"data-migration/internal/tracing"
+	"io"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// traceExporter selects where the trace spans go: none, otlp or stdout
+	traceExporter string
+	// traceEndpoint is the OTLP/HTTP collector address used by the otlp exporter
+	traceEndpoint string
+)
+
+// startTracing installs the span exporter selected by --trace-exporter. The returned function
+// flushes the pending spans.
+func startTracing(logger *config.Logger, stdoutMode bool) (func(), error) {
+	// stdout carries the dump in stdout mode
+	var output io.Writer = os.Stdout
+	if stdoutMode {
+		output = os.Stderr
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:       traceExporter,
+		Endpoint:       traceEndpoint,
+		Output:         output,
+		ServiceVersion: Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if traceExporter != "" && traceExporter != tracing.ExporterNone {
+		logger.Infof("Exporting traces with the %s exporter", traceExporter)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Warnf("Failed to export traces: %v", err)
+		}
+	}, nil
+}
+
+// testConnection runs TestConnection within a trace span; role is source or target
+func testConnection(ctx context.Context, role, dbType, connString string) (err error) {
+	_, span := tracing.Start(ctx, "connection_test", tracing.DBSystem(dbType), attribute.String("migrationdb.role", role))
+	defer func() { tracing.End(span, err) }()
+
+	return TestConnection(dbType, connString)
+}
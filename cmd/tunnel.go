@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"data-migration/internal/config"
+	"data-migration/internal/migration"
+	"data-migration/internal/tunnel"
+	"fmt"
+)
+
+// openTunnels starts the SSH tunnels requested for the source and target and points their
+// connection strings at the local end. The returned function closes the tunnels.
+func openTunnels(cfg *config.Config, logger *config.Logger) (func(), error) {
+	var tunnels []*tunnel.Tunnel
+	closeAll := func() {
+		for _, t := range tunnels {
+			t.Close()
+		}
+	}
+
+	open := func(side, spec, keyFile, dbType string, connString *string) error {
+		if spec == "" {
+			return nil
+		}
+
+		remote, err := migration.ServerAddress(dbType, *connString)
+		if err != nil {
+			return fmt.Errorf("cannot tunnel the %s connection: %w", side, err)
+		}
+
+		opts := []tunnel.Option{tunnel.WithKnownHosts(cfg.SSHKnownHosts)}
+		if keyFile != "" {
+			opts = append(opts, tunnel.WithKeyFile(keyFile))
+		}
+
+		t, err := tunnel.Open(spec, remote, logger.With("tunnel", side), opts...)
+		if err != nil {
+			return fmt.Errorf("%s SSH tunnel: %w", side, err)
+		}
+		tunnels = append(tunnels, t)
+
+		if *connString, err = migration.ReplaceServerAddress(dbType, *connString, t.LocalAddr()); err != nil {
+			return err
+		}
+
+		logger.Infof("Reaching the %s %s through SSH tunnel %s via %s", side, remote, t.LocalAddr(), spec)
+		return nil
+	}
+
+	if err := open("source", cfg.SourceSSH, cfg.SourceSSHKey, cfg.SourceType, &cfg.SourceConn); err != nil {
+		closeAll()
+		return nil, err
+	}
+	if !cfg.StdoutMode {
+		if err := open("target", cfg.TargetSSH, cfg.TargetSSHKey, cfg.TargetType, &cfg.TargetConn); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+
+	return closeAll, nil
+}
@@ -2,47 +2,63 @@ package cmd
 
 import (
 	"context"
+	"data-migration/internal/metrics"
+	"data-migration/internal/migration"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"net/url"
-	"strings"
 	"time"
 )
 
-var (
-	skipTLSVerify bool
-)
-
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate the connection strings and configurations",
 	RunE:  runValidate,
 }
 
-func init() {
-	validateCmd.Flags().BoolVar(&skipTLSVerify, "skip-tls-verify", false, "Skip TLS certificate verification when testing connections")
-}
-
 func runValidate(cmd *cobra.Command, args []string) error {
-	// First validate the configuration
+	// Validate and get database types
+	sourceType, err := ValidateConnections(cfg.SourceConn, cfg.TargetConn, cfg.StdoutMode)
+	if err != nil {
+		return fmt.Errorf("connection validation failed: %v", err)
+	}
+
+	// Validate the merged flag and config file settings
+	cfg.SourceType = sourceType
+	if !cfg.StdoutMode {
+		cfg.TargetType = sourceType
+	}
+	if err := normalizeConnections(cfg); err != nil {
+		return fmt.Errorf("connection validation failed: %v", err)
+	}
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("configuration validation failed: %v", err)
 	}
+	if err := resolveCredentials(cfg); err != nil {
+		return fmt.Errorf("configuration validation failed: %v", err)
+	}
+	if err := applyTLSOptions(cfg); err != nil {
+		return fmt.Errorf("configuration validation failed: %v", err)
+	}
 
-	// Validate and get database types
-	sourceType, err := ValidateConnections(cfg.SourceConn, cfg.TargetConn, cfg.StdoutMode)
+	logger, closeLogger, err := newLogger(cfg)
 	if err != nil {
-		return fmt.Errorf("connection validation failed: %v", err)
+		return err
+	}
+	defer closeLogger()
+
+	closeTunnels, err := openTunnels(cfg, logger)
+	if err != nil {
+		return err
 	}
+	defer closeTunnels()
 
 	// Test source connection
 	fmt.Println("Validate: Testing source connection...")
-	if err := TestConnection(sourceType, cfg.SourceConn, skipTLSVerify); err != nil {
+	if err := TestConnection(sourceType, cfg.SourceConn); err != nil {
 		return fmt.Errorf("source connection test failed: %v", err)
 	}
 	fmt.Println("Source connection test successful!")
@@ -50,7 +66,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	// Test target connection if not in stdout mode
 	if !cfg.StdoutMode {
 		fmt.Println("\nValidate: Testing target connection...")
-		if err := TestConnection(sourceType, cfg.TargetConn, skipTLSVerify); err != nil {
+		if err := TestConnection(sourceType, cfg.TargetConn); err != nil {
 			return fmt.Errorf("target connection test failed: %v", err)
 		}
 		fmt.Println("Target connection test successful!")
@@ -60,45 +76,42 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	fmt.Println("\nConfiguration Summary:")
 	fmt.Println("Source configuration:")
 	fmt.Printf("  Type: %s\n", sourceType)
-	fmt.Printf("  Connection: %s\n", MaskConnectionString(cfg.SourceConn))
+	fmt.Printf("  Connection: %s\n", migration.MaskConnectionString(cfg.SourceConn))
 
 	if !cfg.StdoutMode {
 		fmt.Println("\nTarget configuration:")
 		fmt.Printf("  Type: %s\n", sourceType)
-		fmt.Printf("  Connection: %s\n", MaskConnectionString(cfg.TargetConn))
+		fmt.Printf("  Connection: %s\n", migration.MaskConnectionString(cfg.TargetConn))
 	}
 
 	return nil
 }
 
-// TestConnection attempts to establish a connection to the database
-func TestConnection(dbType, connString string, skipTLSVerify bool) error {
+// TestConnection attempts to establish a connection to the database. TLS settings are read from
+// the connection string, see applyTLSOptions.
+func TestConnection(dbType, connString string) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.RecordError(metrics.ErrorConnection)
+		}
+	}()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	switch dbType {
 	case "postgres", "mysql":
-		finalConnString := connString
-		if skipTLSVerify {
-			// Add SSL/TLS disable parameters if skipTLSVerify is true
-			if dbType == "postgres" && !strings.Contains(connString, "sslmode=") {
-				if strings.Contains(connString, "?") {
-					finalConnString += "&sslmode=disable"
-				} else {
-					finalConnString += "?sslmode=disable"
-				}
-			}
-
-			if dbType == "mysql" && !strings.Contains(connString, "tls=") {
-				if strings.Contains(connString, "?") {
-					finalConnString += "&tls=false"
-				} else {
-					finalConnString += "?tls=false"
-				}
+		driverConnString := connString
+		if dbType == "mysql" {
+			// go-sql-driver expects a DSN rather than a mysql:// URL
+			dsn, err := migration.MySQLDSN(connString)
+			if err != nil {
+				return err
 			}
+			driverConnString = dsn
 		}
 
-		db, err := sql.Open(dbType, finalConnString)
+		db, err := sql.Open(dbType, driverConnString)
 		if err != nil {
 			return fmt.Errorf("failed to create database connection: %v", err)
 		}
@@ -111,15 +124,7 @@ func TestConnection(dbType, connString string, skipTLSVerify bool) error {
 		}
 
 	case "mongodb":
-		clientOptions := options.Client().ApplyURI(connString)
-
-		if skipTLSVerify {
-			clientOptions.SetTLSConfig(nil).
-				SetCompressors([]string{"none"}).
-				SetDirect(true)
-		}
-
-		client, err := mongo.Connect(ctx, clientOptions)
+		client, err := mongo.Connect(ctx, migration.MongoClientOptions(connString))
 		if err != nil {
 			return fmt.Errorf("failed to create MongoDB client: %v", err)
 		}
@@ -138,51 +143,12 @@ func TestConnection(dbType, connString string, skipTLSVerify bool) error {
 	return nil
 }
 
-// MaskConnectionString masks sensitive information in connection strings
-func MaskConnectionString(conn string) string {
-	if conn == "" {
-		return ""
-	}
-
-	// Handle MongoDB connection strings
-	if strings.HasPrefix(conn, "mongodb://") || strings.HasPrefix(conn, "mongodb+srv://") {
-		// Replace password in MongoDB connection string
-		parts := strings.Split(conn, "@")
-		if len(parts) != 2 {
-			return conn // Return original if we can't parse it
-		}
-		auth := strings.Split(parts[0], "://")
-		if len(auth) != 2 {
-			return conn
-		}
-		userPass := strings.Split(auth[1], ":")
-		if len(userPass) != 2 {
-			return conn
-		}
-		return fmt.Sprintf("%s://%s:****@%s", auth[0], userPass[0], parts[1])
-	}
-
-	// Handle SQL connection strings
-	u, err := url.Parse(conn)
-	if err != nil {
-		return conn // Return original if we can't parse it
-	}
-
-	if u.User != nil {
-		_, hasPassword := u.User.Password()
-		if hasPassword {
-			u.User = url.UserPassword(u.User.Username(), "****")
-			// Convert to string and manually unescape the asterisks
-			maskedStr := u.String()
-			return strings.ReplaceAll(maskedStr, "%2A", "*")
-		}
-	}
-
-	return u.String()
-}
-
 // ValidateConnections checks that both connections are valid and of the same type
 func ValidateConnections(sourceConn, targetConn string, stdoutMode bool) (string, error) {
+	if sourceConn == "" {
+		return "", fmt.Errorf("source connection string is required (--source)")
+	}
+
 	sourceType, err := inferDatabaseType(sourceConn)
 	if err != nil {
 		return "", fmt.Errorf("invalid source database: %v", err)
@@ -0,0 +1,58 @@
+// Package anonymize masks personal data in the dump streams of the source databases, following
+// declarative per-column rules
+package anonymize
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Writer masks the dump written to it before passing it on. Close must be called once the dump is
+// complete; it flushes the output and reports any dump the writer could not parse.
+type Writer struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+// NewWriter returns a Writer masking a dump of the given database type into w: plain-format pg_dump
+// output, mysqldump output with --complete-insert, or a mongodump archive
+func NewWriter(dbType string, w io.Writer, rules *Rules) (*Writer, error) {
+	var mask func(*bufio.Reader, *bufio.Writer, *Rules) error
+	switch dbType {
+	case "postgres":
+		mask = maskPostgres
+	case "mysql":
+		mask = maskMySQL
+	case "mongodb":
+		mask = maskMongoDB
+	default:
+		return nil, fmt.Errorf("masking is not supported for %s", dbType)
+	}
+
+	reader, writer := io.Pipe()
+	mw := &Writer{pipe: writer, done: make(chan error, 1)}
+
+	go func() {
+		out := bufio.NewWriterSize(w, 64*1024)
+		err := mask(bufio.NewReaderSize(reader, 64*1024), out, rules)
+		if err == nil {
+			err = out.Flush()
+		}
+		// Unblock the dump tool when masking stops early
+		reader.CloseWithError(err)
+		mw.done <- err
+	}()
+
+	return mw, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close ends the dump and waits until its masked output is written
+func (w *Writer) Close() error {
+	w.pipe.Close()
+	return <-w.done
+}
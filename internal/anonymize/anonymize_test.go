@@ -0,0 +1,47 @@
+package anonymize
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	rules := testRules(Rule{Table: "users", Column: "email", Transform: TransformConstant, Value: "masked"})
+	dump := "COPY public.users (id, email) FROM stdin;\n1\talice@example.com\n\\.\n"
+
+	var out bytes.Buffer
+	w, err := NewWriter("postgres", &out, rules)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	// Lines may be split across writes
+	for _, part := range []string{dump[:10], dump[10:50], dump[50:]} {
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if want := "COPY public.users (id, email) FROM stdin;\n1\tmasked\n\\.\n"; out.String() != want {
+		t.Errorf("masked dump = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	rules := testRules(Rule{Table: "users", Column: "email", Transform: TransformHash})
+
+	if _, err := NewWriter("sqlite", &bytes.Buffer{}, rules); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("NewWriter(sqlite) error = %v", err)
+	}
+
+	w, err := NewWriter("mysql", &bytes.Buffer{}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("INSERT INTO `users` VALUES (1,'a');\n"))
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "--complete-insert") {
+		t.Errorf("Close() error = %v, want the masking error", err)
+	}
+}
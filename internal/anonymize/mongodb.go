@@ -0,0 +1,244 @@
+package anonymize
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mongodump archives start with this magic number, and end their prelude and every segment with a
+// terminator in place of a document length
+const (
+	archiveMagic      = 0x8199e26d
+	archiveTerminator = 0xffffffff
+)
+
+// namespaceHeader opens a segment of a mongodump archive
+type namespaceHeader struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"collection"`
+	EOF        bool   `bson:"EOF"`
+	CRC        int64  `bson:"CRC"`
+}
+
+// maskMongoDB rewrites the documents of a mongodump --archive stream. The archive interleaves
+// segments of the dumped collections, each one a namespace header followed by documents; the last
+// header of a collection carries the CRC of all its documents, which is recomputed once masked.
+func maskMongoDB(r *bufio.Reader, w *bufio.Writer, rules *Rules) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic[:]) != archiveMagic {
+		return fmt.Errorf("not a mongodump archive")
+	}
+	w.Write(magic[:])
+
+	// Prelude: the archive and collection metadata
+	for {
+		doc, err := readArchiveDocument(r)
+		if err != nil {
+			return fmt.Errorf("failed to read archive prelude: %w", err)
+		}
+		w.Write(doc)
+		if doc == nil {
+			w.Write(terminator())
+			break
+		}
+	}
+
+	crcs := make(map[string]hash.Hash64)
+	var fields map[string]*Rule
+	var namespace string
+	inSegment := false
+	for {
+		doc, err := readArchiveDocument(r)
+		if err == io.EOF && !inSegment {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		switch {
+		case doc == nil:
+			inSegment = false
+			w.Write(terminator())
+		case !inSegment:
+			var header namespaceHeader
+			if err := bson.Unmarshal(doc, &header); err != nil {
+				return fmt.Errorf("failed to read archive namespace header: %w", err)
+			}
+			inSegment = true
+			namespace = header.Database + "." + header.Collection
+			fields = rules.columns(header.Database, header.Collection)
+
+			crc := crcs[namespace]
+			if header.EOF && crc != nil && header.CRC != 0 {
+				if doc, err = rewriteCRC(doc, int64(crc.Sum64())); err != nil {
+					return err
+				}
+			}
+			w.Write(doc)
+		case fields != nil:
+			if doc, err = maskDocument(doc, fields, rules.key); err != nil {
+				return fmt.Errorf("failed to mask a document of %s: %w", namespace, err)
+			}
+			crc := crcs[namespace]
+			if crc == nil {
+				crc = crc64.New(crc64.MakeTable(crc64.ECMA))
+				crcs[namespace] = crc
+			}
+			crc.Write(doc)
+			w.Write(doc)
+		default:
+			w.Write(doc)
+		}
+	}
+}
+
+// readArchiveDocument reads a BSON document, or returns nil on a terminator
+func readArchiveDocument(r *bufio.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(size[:])
+	if length == archiveTerminator {
+		return nil, nil
+	}
+	if length < 5 || length > 16*1024*1024+16*1024 {
+		return nil, fmt.Errorf("invalid document length %d", length)
+	}
+
+	doc := make([]byte, length)
+	copy(doc, size[:])
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+func terminator() []byte {
+	return binary.LittleEndian.AppendUint32(nil, archiveTerminator)
+}
+
+// rewriteCRC replaces the CRC of a namespace header, keeping its other fields in order
+func rewriteCRC(doc []byte, crc int64) ([]byte, error) {
+	var header bson.D
+	if err := bson.Unmarshal(doc, &header); err != nil {
+		return nil, fmt.Errorf("failed to read archive namespace header: %w", err)
+	}
+	for i := range header {
+		if header[i].Key == "CRC" {
+			header[i].Value = crc
+		}
+	}
+	return bson.Marshal(header)
+}
+
+// maskDocument applies the rules to the fields of a document, given by their dotted paths
+func maskDocument(doc []byte, fields map[string]*Rule, key []byte) ([]byte, error) {
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for path, rule := range fields {
+		if maskPath(d, strings.Split(path, "."), rule, key) {
+			changed = true
+		}
+	}
+	if !changed {
+		return doc, nil
+	}
+	return bson.Marshal(d)
+}
+
+// maskPath masks the field at path in d, descending into embedded documents and arrays
+func maskPath(d bson.D, path []string, rule *Rule, key []byte) bool {
+	for i := range d {
+		if d[i].Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			if d[i].Value == nil {
+				return false
+			}
+			d[i].Value = maskValue(d[i].Value, rule, key)
+			return true
+		}
+		return maskNested(d[i].Value, path[1:], rule, key)
+	}
+	return false
+}
+
+func maskNested(value interface{}, path []string, rule *Rule, key []byte) bool {
+	switch v := value.(type) {
+	case bson.D:
+		return maskPath(v, path, rule, key)
+	case bson.A:
+		changed := false
+		for _, element := range v {
+			if maskNested(element, path, rule, key) {
+				changed = true
+			}
+		}
+		return changed
+	}
+	return false
+}
+
+// maskValue masks a field value. Numbers stay numbers when the masked value still parses as one;
+// other non-string values are masked through their string form.
+func maskValue(value interface{}, rule *Rule, key []byte) interface{} {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case int32:
+		s = strconv.FormatInt(int64(v), 10)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case primitive.ObjectID:
+		s = v.Hex()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	masked, null := rule.apply(key, s)
+	if null {
+		return nil
+	}
+
+	switch value.(type) {
+	case int32:
+		if n, err := strconv.ParseInt(masked, 10, 32); err == nil {
+			return int32(n)
+		}
+	case int64:
+		if n, err := strconv.ParseInt(masked, 10, 64); err == nil {
+			return n
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(masked, 64); err == nil {
+			return f
+		}
+	}
+	return masked
+}
@@ -0,0 +1,177 @@
+package anonymize
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func marshalDoc(t *testing.T, doc bson.D) []byte {
+	t.Helper()
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func archiveCRC(docs ...[]byte) int64 {
+	crc := crc64.New(crc64.MakeTable(crc64.ECMA))
+	for _, doc := range docs {
+		crc.Write(doc)
+	}
+	return int64(crc.Sum64())
+}
+
+func header(t *testing.T, collection string, eof bool, crc int64) []byte {
+	t.Helper()
+	return marshalDoc(t, bson.D{{Key: "db", Value: "shop"}, {Key: "collection", Value: collection}, {Key: "EOF", Value: eof}, {Key: "CRC", Value: crc}})
+}
+
+// readArchive splits a masked archive into its prelude and its segments, each a header and documents
+func readArchive(t *testing.T, archive []byte) (prelude [][]byte, segments [][][]byte) {
+	t.Helper()
+	if !bytes.HasPrefix(archive, binary.LittleEndian.AppendUint32(nil, archiveMagic)) {
+		t.Fatal("masked archive lost its magic number")
+	}
+	r := bufio.NewReader(bytes.NewReader(archive[4:]))
+	for {
+		doc, err := readArchiveDocument(r)
+		if err != nil {
+			t.Fatalf("invalid masked prelude: %v", err)
+		}
+		if doc == nil {
+			break
+		}
+		prelude = append(prelude, doc)
+	}
+
+	var segment [][]byte
+	for {
+		doc, err := readArchiveDocument(r)
+		if err != nil {
+			if len(segment) > 0 {
+				t.Fatalf("invalid masked archive: %v", err)
+			}
+			return prelude, segments
+		}
+		if doc == nil {
+			segments = append(segments, segment)
+			segment = nil
+			continue
+		}
+		segment = append(segment, doc)
+	}
+}
+
+func TestMaskMongoDB(t *testing.T) {
+	rules := testRules(
+		Rule{Table: "shop.users", Column: "email", Transform: TransformHash},
+		Rule{Table: "users", Column: "address.city", Transform: TransformConstant, Value: "Nowhere"},
+		Rule{Table: "users", Column: "contacts.email", Transform: TransformFakeEmail},
+		Rule{Table: "users", Column: "age", Transform: TransformKeepLastDigits, Digits: 1},
+		Rule{Table: "users", Column: "note", Transform: TransformHash},
+		Rule{Table: "users", Column: "missing.field", Transform: TransformNull},
+	)
+
+	alice := marshalDoc(t, bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "email", Value: "alice@example.com"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Paris"}, {Key: "zip", Value: "75001"}}},
+		{Key: "contacts", Value: bson.A{bson.D{{Key: "email", Value: "a@b.c"}}, "loose", bson.D{{Key: "phone", Value: "555"}}}},
+		{Key: "age", Value: int32(42)},
+		{Key: "note", Value: nil},
+	})
+	bare := marshalDoc(t, bson.D{{Key: "_id", Value: int32(2)}, {Key: "name", Value: "Bob"}})
+	order := marshalDoc(t, bson.D{{Key: "_id", Value: int32(1)}, {Key: "email", Value: "kept@example.com"}})
+
+	var input bytes.Buffer
+	input.Write(binary.LittleEndian.AppendUint32(nil, archiveMagic))
+	prelude := marshalDoc(t, bson.D{{Key: "version", Value: "0.1"}, {Key: "server", Value: "7.0.0"}})
+	for _, doc := range [][]byte{prelude, nil, header(t, "users", false, 0), alice, nil, header(t, "orders", false, 0), order, nil,
+		header(t, "users", false, 0), bare, nil, header(t, "users", true, archiveCRC(alice, bare)), nil,
+		header(t, "orders", true, archiveCRC(order)), nil} {
+		if doc == nil {
+			doc = terminator()
+		}
+		input.Write(doc)
+	}
+
+	masked, err := mask(t, maskMongoDB, input.String(), rules)
+	if err != nil {
+		t.Fatalf("maskMongoDB() error = %v", err)
+	}
+	gotPrelude, segments := readArchive(t, []byte(masked))
+	if len(gotPrelude) != 1 || !bytes.Equal(gotPrelude[0], prelude) {
+		t.Errorf("prelude = %v, want it unchanged", gotPrelude)
+	}
+	if len(segments) != 5 {
+		t.Fatalf("masked archive has %d segments, want 5", len(segments))
+	}
+
+	var got bson.D
+	if err := bson.Unmarshal(segments[0][1], &got); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := rules.Rules[0].apply(rules.key, "alice@example.com")
+	email, _ := rules.Rules[2].apply(rules.key, "a@b.c")
+	maskedAge, _ := rules.Rules[3].apply(rules.key, "42")
+	age, err := strconv.ParseInt(maskedAge, 10, 32)
+	if err != nil || maskedAge[1] != '2' {
+		t.Fatalf("keep_last_digits(42) = %q", maskedAge)
+	}
+	want := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "email", Value: hash},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Nowhere"}, {Key: "zip", Value: "75001"}}},
+		{Key: "contacts", Value: bson.A{bson.D{{Key: "email", Value: email}}, "loose", bson.D{{Key: "phone", Value: "555"}}}},
+		{Key: "age", Value: int32(age)},
+		{Key: "note", Value: nil},
+	}
+	if !bytes.Equal(segments[0][1], marshalDoc(t, want)) {
+		t.Errorf("masked document = %v, want %v", got, want)
+	}
+
+	if !bytes.Equal(segments[1][1], order) || !bytes.Equal(segments[4][0], header(t, "orders", true, archiveCRC(order))) {
+		t.Error("collection without rules was changed")
+	}
+	if !bytes.Equal(segments[2][1], bare) {
+		t.Error("document without masked field was re-encoded")
+	}
+	if wantHeader := header(t, "users", true, archiveCRC(segments[0][1], bare)); !bytes.Equal(segments[3][0], wantHeader) {
+		t.Errorf("EOF header = %v, want the CRC of the masked documents", bson.Raw(segments[3][0]))
+	}
+}
+
+func TestMaskMongoDBErrors(t *testing.T) {
+	rules := testRules(Rule{Table: "users", Column: "email", Transform: TransformHash})
+	magic := string(binary.LittleEndian.AppendUint32(nil, archiveMagic))
+	doc := string(marshalDoc(t, bson.D{{Key: "email", Value: "a"}}))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "empty", input: "", wantErr: "failed to read archive"},
+		{name: "not an archive", input: "\x00\x00\x00\x00", wantErr: "not a mongodump archive"},
+		{name: "truncated prelude", input: magic + doc[:7], wantErr: "prelude"},
+		{name: "invalid length", input: magic + string(terminator()) + "\x02\x00\x00\x00", wantErr: "invalid document length 2"},
+		{name: "unterminated segment", input: magic + string(terminator()) + string(header(t, "users", false, 0)) + doc, wantErr: "EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mask(t, maskMongoDB, tt.input, rules)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("maskMongoDB() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package anonymize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var insertPrefix = []byte("INSERT INTO `")
+
+// maskMySQL rewrites the INSERT statements of a mysqldump output. mysqldump writes every statement on
+// its own line and, with --complete-insert, names the inserted columns.
+func maskMySQL(r *bufio.Reader, w *bufio.Writer, rules *Rules) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, insertPrefix) {
+				if maskErr := maskInsert(w, line, rules); maskErr != nil {
+					return maskErr
+				}
+			} else {
+				w.Write(line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// maskInsert writes an INSERT INTO `table` (`col`, ...) VALUES (...),(...); statement with its values masked
+func maskInsert(w *bufio.Writer, line []byte, rules *Rules) error {
+	p := &sqlParser{s: string(line)}
+	p.consume("INSERT INTO ")
+	table, err := p.backquoted()
+	if err != nil {
+		return fmt.Errorf("cannot parse INSERT statement: %w", err)
+	}
+
+	tableRules := rules.columns("", table)
+	if tableRules == nil {
+		w.Write(line)
+		return nil
+	}
+	if !p.consume(" (") {
+		return fmt.Errorf("cannot mask INSERT into %s: the column names are missing, dump with --complete-insert", table)
+	}
+
+	var columns []*Rule
+	for {
+		column, err := p.backquoted()
+		if err != nil {
+			return fmt.Errorf("cannot parse INSERT into %s: %w", table, err)
+		}
+		columns = append(columns, tableRules[column])
+		if !p.consume(", ") {
+			break
+		}
+	}
+	if !p.consume(") VALUES ") {
+		return fmt.Errorf("cannot parse INSERT into %s: expected VALUES", table)
+	}
+	w.WriteString(string(line[:len(line)-len(p.s)]))
+
+	for {
+		if !p.consume("(") {
+			return fmt.Errorf("cannot parse INSERT into %s: expected a row", table)
+		}
+		w.WriteByte('(')
+		for i := 0; ; i++ {
+			raw, value, isString, err := p.value()
+			if err != nil {
+				return fmt.Errorf("cannot parse INSERT into %s: %w", table, err)
+			}
+			if i >= len(columns) {
+				return fmt.Errorf("cannot parse INSERT into %s: more values than columns", table)
+			}
+
+			rule := columns[i]
+			switch {
+			case rule == nil || raw == "NULL":
+				w.WriteString(raw)
+			default:
+				// Keep introducers such as _binary in front of masked strings
+				prefix := ""
+				if isString {
+					prefix = raw[:strings.IndexByte(raw, '\'')]
+				} else {
+					value = raw
+				}
+				masked, null := rule.apply(rules.key, value)
+				if null {
+					w.WriteString("NULL")
+				} else {
+					w.WriteString(prefix + quoteMySQLString(masked))
+				}
+			}
+
+			if p.consume(",") {
+				w.WriteByte(',')
+				continue
+			}
+			if p.consume(")") {
+				w.WriteByte(')')
+				break
+			}
+			return fmt.Errorf("cannot parse INSERT into %s: expected ',' or ')'", table)
+		}
+
+		if p.consume(",") {
+			w.WriteByte(',')
+			continue
+		}
+		w.WriteString(p.s)
+		return nil
+	}
+}
+
+// sqlParser reads the tokens of mysqldump INSERT statements
+type sqlParser struct {
+	s string
+}
+
+func (p *sqlParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s, prefix) {
+		p.s = p.s[len(prefix):]
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) backquoted() (string, error) {
+	if !p.consume("`") {
+		return "", fmt.Errorf("expected a quoted identifier")
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(p.s, '`')
+		if i < 0 {
+			return "", fmt.Errorf("unterminated identifier")
+		}
+		b.WriteString(p.s[:i])
+		p.s = p.s[i+1:]
+		if !p.consume("`") {
+			return b.String(), nil
+		}
+		b.WriteByte('`')
+	}
+}
+
+// value reads a literal: a quoted string, possibly introduced like _binary 'abc', or a bare token
+// such as a number, NULL or 0x1F. raw is the literal as written, value the unescaped string.
+func (p *sqlParser) value() (raw, value string, isString bool, err error) {
+	start := p.s
+	i := 0
+	for i < len(p.s) && p.s[i] != ',' && p.s[i] != ')' && p.s[i] != '\'' {
+		i++
+	}
+	if i == len(p.s) {
+		return "", "", false, fmt.Errorf("unterminated row")
+	}
+	if p.s[i] != '\'' {
+		raw = p.s[:i]
+		p.s = p.s[i:]
+		return raw, "", false, nil
+	}
+
+	// Quoted string, with backslash escapes
+	var b strings.Builder
+	for i++; ; i++ {
+		if i >= len(p.s) {
+			return "", "", false, fmt.Errorf("unterminated string")
+		}
+		c := p.s[i]
+		if c == '\'' {
+			if i+1 < len(p.s) && p.s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			break
+		}
+		if c != '\\' || i+1 == len(p.s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch p.s[i] {
+		case '0':
+			b.WriteByte(0)
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'Z':
+			b.WriteByte(0x1a)
+		default:
+			b.WriteByte(p.s[i])
+		}
+	}
+	p.s = p.s[i+1:]
+	return start[:len(start)-len(p.s)], b.String(), true, nil
+}
+
+var mysqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+func quoteMySQLString(value string) string {
+	return "'" + mysqlEscaper.Replace(value) + "'"
+}
@@ -0,0 +1,121 @@
+package anonymize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSQLParserValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		raw      string
+		value    string
+		isString bool
+		rest     string
+	}{
+		{name: "string", input: "'abc',1)", raw: "'abc'", value: "abc", isString: true, rest: ",1)"},
+		{name: "empty string", input: "'')", raw: "''", value: "", isString: true, rest: ")"},
+		{name: "doubled quote", input: "'it''s')", raw: "'it''s'", value: "it's", isString: true, rest: ")"},
+		{name: "backslash escapes", input: `'a\'b\\c\"d\n\r\t\b\Z\0\%')`, raw: `'a\'b\\c\"d\n\r\t\b\Z\0\%'`, value: "a'b\\c\"d\n\r\t\b\x1a\x00%", isString: true, rest: ")"},
+		{name: "separators in string", input: "'a,b)c'),(", raw: "'a,b)c'", value: "a,b)c", isString: true, rest: "),("},
+		{name: "binary introducer", input: "_binary 'x\\0y',", raw: "_binary 'x\\0y'", value: "x\x00y", isString: true, rest: ","},
+		{name: "null", input: "NULL,", raw: "NULL", rest: ","},
+		{name: "number", input: "-12.5e3)", raw: "-12.5e3", rest: ")"},
+		{name: "hex", input: "0x1F,", raw: "0x1F", rest: ","},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &sqlParser{s: tt.input}
+			raw, value, isString, err := p.value()
+			if err != nil {
+				t.Fatalf("value() error = %v", err)
+			}
+			if raw != tt.raw || value != tt.value || isString != tt.isString || p.s != tt.rest {
+				t.Errorf("value() = %q, %q, %v, rest %q, want %q, %q, %v, rest %q",
+					raw, value, isString, p.s, tt.raw, tt.value, tt.isString, tt.rest)
+			}
+		})
+	}
+}
+
+func TestSQLParserValueErrors(t *testing.T) {
+	for _, input := range []string{"'abc", `'abc\'`, "12", ""} {
+		p := &sqlParser{s: input}
+		if _, _, _, err := p.value(); err == nil {
+			t.Errorf("value(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestQuoteMySQLStringRoundTrip(t *testing.T) {
+	values := []string{"", "plain", "it's", `back\slash`, "nul\x00byte", "new\nline\r", "ctrl-z\x1a", `"quoted"`, "café"}
+	for _, value := range values {
+		p := &sqlParser{s: quoteMySQLString(value) + ")"}
+		_, got, isString, err := p.value()
+		if err != nil || !isString || got != value || p.s != ")" {
+			t.Errorf("value(quoteMySQLString(%q)) = %q, %v, %v, rest %q", value, got, isString, err, p.s)
+		}
+	}
+}
+
+func TestMaskMySQL(t *testing.T) {
+	rules := testRules(
+		Rule{Table: "users", Column: "email", Transform: TransformHash},
+		Rule{Table: "users", Column: "phone", Transform: TransformNull},
+		Rule{Table: "users", Column: "pin", Transform: TransformConstant, Value: "it's\n"},
+		Rule{Table: "odd`name", Column: "secret", Transform: TransformConstant, Value: "x"},
+	)
+	hash := func(value string) string {
+		masked, _ := rules.Rules[0].apply(rules.key, value)
+		return masked
+	}
+
+	input := "-- MySQL dump\n" +
+		"LOCK TABLES `users` WRITE;\n" +
+		"INSERT INTO `users` (`id`, `email`, `phone`, `pin`) VALUES " +
+		"(1,'a''b@example.com','555',1234),(2,NULL,NULL,NULL),(3,_binary 'c\\\\d','',0x1F);\n" +
+		"INSERT INTO `orders` (`id`, `email`) VALUES (1,'kept@example.com');\n" +
+		"INSERT INTO `odd``name` (`secret`) VALUES ('s');\n" +
+		"UNLOCK TABLES;\n"
+	want := "-- MySQL dump\n" +
+		"LOCK TABLES `users` WRITE;\n" +
+		"INSERT INTO `users` (`id`, `email`, `phone`, `pin`) VALUES " +
+		"(1,'" + hash("a'b@example.com") + "',NULL,'it\\'s\\n'),(2,NULL,NULL,NULL),(3,_binary '" + hash(`c\d`) + "',NULL,'it\\'s\\n');\n" +
+		"INSERT INTO `orders` (`id`, `email`) VALUES (1,'kept@example.com');\n" +
+		"INSERT INTO `odd``name` (`secret`) VALUES ('x');\n" +
+		"UNLOCK TABLES;\n"
+
+	got, err := mask(t, maskMySQL, input, rules)
+	if err != nil {
+		t.Fatalf("maskMySQL() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("maskMySQL() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMaskMySQLErrors(t *testing.T) {
+	rules := testRules(Rule{Table: "users", Column: "email", Transform: TransformHash})
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "no column names", input: "INSERT INTO `users` VALUES (1,'a');\n", wantErr: "--complete-insert"},
+		{name: "more values than columns", input: "INSERT INTO `users` (`email`) VALUES ('a','b');\n", wantErr: "more values than columns"},
+		{name: "unterminated string", input: "INSERT INTO `users` (`email`) VALUES ('a);\n", wantErr: "unterminated string"},
+		{name: "no values", input: "INSERT INTO `users` (`email`) SELECT 'a';\n", wantErr: "expected VALUES"},
+		{name: "unterminated row", input: "INSERT INTO `users` (`email`) VALUES ('a'\n", wantErr: "expected ',' or ')'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mask(t, maskMySQL, tt.input, rules)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("maskMySQL() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
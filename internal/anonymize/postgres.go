@@ -0,0 +1,214 @@
+package anonymize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maskPostgres rewrites the rows of the COPY ... FROM stdin blocks of a plain-format dump
+func maskPostgres(r *bufio.Reader, w *bufio.Writer, rules *Rules) error {
+	var columns []*Rule
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case columns != nil && bytes.Equal(line, []byte("\\.\n")):
+				columns = nil
+				w.Write(line)
+			case columns != nil:
+				if err := maskCopyRow(w, line, columns, rules.key); err != nil {
+					return err
+				}
+			default:
+				if bytes.HasPrefix(line, []byte("COPY ")) && bytes.HasSuffix(line, []byte(" FROM stdin;\n")) {
+					if columns, err = copyColumns(string(line), rules); err != nil {
+						return err
+					}
+				}
+				w.Write(line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyColumns returns the rule of every column of a COPY statement, or nil when none applies
+func copyColumns(statement string, rules *Rules) ([]*Rule, error) {
+	p := &identParser{s: strings.TrimPrefix(statement, "COPY ")}
+	name, err := p.ident()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", strings.TrimSpace(statement), err)
+	}
+	schema := ""
+	if p.consume(".") {
+		schema = name
+		if name, err = p.ident(); err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", strings.TrimSpace(statement), err)
+		}
+	}
+
+	tableRules := rules.columns(schema, name)
+	if tableRules == nil || !p.consume(" (") {
+		return nil, nil
+	}
+
+	var columns []*Rule
+	masked := false
+	for {
+		column, err := p.ident()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", strings.TrimSpace(statement), err)
+		}
+		columns = append(columns, tableRules[column])
+		masked = masked || tableRules[column] != nil
+		if !p.consume(", ") {
+			break
+		}
+	}
+	if !masked {
+		return nil, nil
+	}
+	return columns, nil
+}
+
+// maskCopyRow masks a row of the COPY text format: tab-separated fields, \N for NULL and backslash escapes
+func maskCopyRow(w *bufio.Writer, line []byte, columns []*Rule, key []byte) error {
+	fields := bytes.Split(bytes.TrimSuffix(line, []byte("\n")), []byte("\t"))
+	if len(fields) != len(columns) {
+		return fmt.Errorf("COPY row has %d fields, expected %d", len(fields), len(columns))
+	}
+
+	for i, field := range fields {
+		if i > 0 {
+			w.WriteByte('\t')
+		}
+		rule := columns[i]
+		if rule == nil || string(field) == `\N` {
+			w.Write(field)
+			continue
+		}
+
+		masked, null := rule.apply(key, unescapeCopy(field))
+		if null {
+			w.WriteString(`\N`)
+		} else {
+			w.WriteString(escapeCopy(masked))
+		}
+	}
+	return w.WriteByte('\n')
+}
+
+func unescapeCopy(field []byte) string {
+	if bytes.IndexByte(field, '\\') < 0 {
+		return string(field)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = field[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			// \xHH, one or two hexadecimal digits
+			end := i + 1
+			for end < len(field) && end < i+3 && isHex(field[end]) {
+				end++
+			}
+			if end == i+1 {
+				b.WriteByte('x')
+				continue
+			}
+			n, _ := strconv.ParseUint(string(field[i+1:end]), 16, 8)
+			b.WriteByte(byte(n))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// \NNN, one to three octal digits
+			end := i + 1
+			for end < len(field) && end < i+3 && field[end] >= '0' && field[end] <= '7' {
+				end++
+			}
+			n, _ := strconv.ParseUint(string(field[i:end]), 8, 8)
+			b.WriteByte(byte(n))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func escapeCopy(value string) string {
+	return copyEscaper.Replace(value)
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// identParser reads the identifiers of pg_dump statements, double-quoted when needed
+type identParser struct {
+	s string
+}
+
+func (p *identParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s, prefix) {
+		p.s = p.s[len(prefix):]
+		return true
+	}
+	return false
+}
+
+func (p *identParser) ident() (string, error) {
+	if p.consume(`"`) {
+		var b strings.Builder
+		for {
+			i := strings.IndexByte(p.s, '"')
+			if i < 0 {
+				return "", fmt.Errorf("unterminated quoted identifier")
+			}
+			b.WriteString(p.s[:i])
+			p.s = p.s[i+1:]
+			if !p.consume(`"`) {
+				return b.String(), nil
+			}
+			b.WriteByte('"')
+		}
+	}
+
+	end := strings.IndexFunc(p.s, func(c rune) bool {
+		return !(c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c > 127)
+	})
+	if end <= 0 {
+		return "", fmt.Errorf("expected an identifier")
+	}
+	name := p.s[:end]
+	p.s = p.s[end:]
+	return name, nil
+}
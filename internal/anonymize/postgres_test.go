@@ -0,0 +1,124 @@
+package anonymize
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testRules(rules ...Rule) *Rules {
+	return &Rules{Seed: testSeed, Rules: rules, key: []byte(testSeed)}
+}
+
+func mask(t *testing.T, fn func(*bufio.Reader, *bufio.Writer, *Rules) error, input string, rules *Rules) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	err := fn(bufio.NewReader(strings.NewReader(input)), w, rules)
+	w.Flush()
+	return out.String(), err
+}
+
+func TestUnescapeCopy(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "plain", want: "plain"},
+		{field: `a\\b`, want: `a\b`},
+		{field: `tab\there`, want: "tab\there"},
+		{field: `\b\f\n\r\t\v`, want: "\b\f\n\r\t\v"},
+		{field: `\x41\x4a\x4Bz`, want: "AJKz"},
+		{field: `\x4`, want: "\x04"},
+		{field: `\xg`, want: "xg"},
+		{field: `\101\60\0`, want: "A0\x00"},
+		{field: `\1012`, want: "A2"},
+		{field: `\q`, want: "q"},
+		{field: `trailing\`, want: `trailing\`},
+		{field: `caf\303\251`, want: "café"},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeCopy([]byte(tt.field)); got != tt.want {
+			t.Errorf("unescapeCopy(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeCopyRoundTrip(t *testing.T) {
+	values := []string{"", "plain", `back\slash`, "tab\tnew\nline\rreturn", `\N`, `\\.`, "café"}
+	for _, value := range values {
+		escaped := escapeCopy(value)
+		if strings.ContainsAny(escaped, "\t\n\r") {
+			t.Errorf("escapeCopy(%q) = %q keeps a separator", value, escaped)
+		}
+		if got := unescapeCopy([]byte(escaped)); got != value {
+			t.Errorf("unescapeCopy(escapeCopy(%q)) = %q", value, got)
+		}
+	}
+}
+
+func TestMaskPostgres(t *testing.T) {
+	rules := testRules(
+		Rule{Table: "public.users", Column: "email", Transform: TransformHash},
+		Rule{Table: "users", Column: "note", Transform: TransformConstant, Value: "line\none\ttab\\"},
+		Rule{Table: "users", Column: "phone", Transform: TransformNull},
+		Rule{Table: "User Data", Column: `e"mail`, Transform: TransformHash, Length: 4},
+	)
+	hash, _ := rules.Rules[0].apply(rules.key, "a\tb@example.com")
+	short, _ := rules.Rules[3].apply(rules.key, "x@y")
+
+	input := "-- PostgreSQL database dump\n" +
+		"COPY public.users (id, email, note, phone) FROM stdin;\n" +
+		"1\ta\\tb@example.com\tsecret\t555\n" +
+		"2\t\\N\t\\N\t\\N\n" +
+		"\\.\n" +
+		"COPY public.orders (id, email) FROM stdin;\n" +
+		"1\tuntouched@example.com\n" +
+		"\\.\n" +
+		"COPY \"public\".\"User Data\" (id, \"e\"\"mail\") FROM stdin;\n" +
+		"1\tx@y\n" +
+		"\\.\n" +
+		"SELECT pg_catalog.setval('public.users_id_seq', 2, true);\n"
+	want := "-- PostgreSQL database dump\n" +
+		"COPY public.users (id, email, note, phone) FROM stdin;\n" +
+		"1\t" + hash + "\tline\\none\\ttab\\\\\t\\N\n" +
+		"2\t\\N\t\\N\t\\N\n" +
+		"\\.\n" +
+		"COPY public.orders (id, email) FROM stdin;\n" +
+		"1\tuntouched@example.com\n" +
+		"\\.\n" +
+		"COPY \"public\".\"User Data\" (id, \"e\"\"mail\") FROM stdin;\n" +
+		"1\t" + short + "\n" +
+		"\\.\n" +
+		"SELECT pg_catalog.setval('public.users_id_seq', 2, true);\n"
+
+	got, err := mask(t, maskPostgres, input, rules)
+	if err != nil {
+		t.Fatalf("maskPostgres() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("maskPostgres() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMaskPostgresErrors(t *testing.T) {
+	rules := testRules(Rule{Table: "users", Column: "email", Transform: TransformHash})
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing field", input: "COPY public.users (id, email) FROM stdin;\n1\n\\.\n"},
+		{name: "extra field", input: "COPY public.users (id, email) FROM stdin;\n1\ta\tb\n\\.\n"},
+		{name: "unterminated identifier", input: "COPY \"users (id) FROM stdin;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mask(t, maskPostgres, tt.input, rules); err == nil {
+				t.Fatal("maskPostgres() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package anonymize
+
+import (
+	"bytes"
+	"data-migration/internal/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Transforms
+const (
+	TransformHash             = "hash"
+	TransformFakeEmail        = "fake_email"
+	TransformFakeName         = "fake_name"
+	TransformNull             = "null"
+	TransformConstant         = "constant"
+	TransformKeepLastDigits   = "keep_last_digits"
+	TransformFormatPreserving = "format_preserving"
+)
+
+// Default number of hexadecimal characters produced by the hash transform
+const defaultHashLength = 16
+
+// Rules are the masking rules of a rules file
+type Rules struct {
+	// Seed keys the transforms: the same value is always masked the same way under the same seed,
+	// whatever its table, so joins keep lining up
+	Seed  string `yaml:"seed" toml:"seed"`
+	Rules []Rule `yaml:"rules" toml:"rules"`
+
+	key []byte
+}
+
+// Rule masks a column of a table, or a field of a MongoDB collection
+type Rule struct {
+	// Table is the source table as table or schema.table, or the collection as collection or db.collection
+	Table string `yaml:"table" toml:"table"`
+	// Column is the column name, or the dotted path of a MongoDB document field
+	Column string `yaml:"column" toml:"column"`
+	// Transform is one of hash, fake_email, fake_name, null, constant, keep_last_digits or format_preserving
+	Transform string `yaml:"transform" toml:"transform"`
+	// Value is the replacement of the constant transform
+	Value string `yaml:"value" toml:"value"`
+	// Digits is the number of trailing digits kept by keep_last_digits
+	Digits int `yaml:"digits" toml:"digits"`
+	// Length is the number of characters produced by hash, 16 by default
+	Length int `yaml:"length" toml:"length"`
+}
+
+// LoadRules reads a YAML (.yaml, .yml) or TOML (.toml) rules file. ${VAR} references in the seed
+// are replaced by environment variables, so that the seed does not have to be stored in the file.
+func LoadRules(path string) (*Rules, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var rules Rules
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&rules)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(content), &rules)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown key %q", meta.Undecoded()[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file format %q: expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if rules.Seed, err = config.ExpandEnv(rules.Seed); err != nil {
+		return nil, fmt.Errorf("%s: seed: %w", path, err)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rules.key = []byte(rules.Seed)
+
+	return &rules, nil
+}
+
+func (r *Rules) validate() error {
+	if r.Seed == "" {
+		return fmt.Errorf("seed is required, e.g. seed: ${MASK_SEED}")
+	}
+	if len(r.Rules) == 0 {
+		return fmt.Errorf("no rules defined")
+	}
+
+	for i, rule := range r.Rules {
+		if rule.Table == "" || rule.Column == "" {
+			return fmt.Errorf("rule %d: table and column are required", i+1)
+		}
+		switch rule.Transform {
+		case TransformHash:
+			if rule.Length < 0 || rule.Length > 64 {
+				return fmt.Errorf("rule %d: length must be between 1 and 64, or 0 for the default of %d", i+1, defaultHashLength)
+			}
+		case TransformKeepLastDigits:
+			if rule.Digits < 0 {
+				return fmt.Errorf("rule %d: digits cannot be negative", i+1)
+			}
+		case TransformFakeEmail, TransformFakeName, TransformNull, TransformConstant, TransformFormatPreserving:
+		default:
+			return fmt.Errorf("rule %d: unknown transform %q: expected %s", i+1, rule.Transform, strings.Join([]string{
+				TransformHash, TransformFakeEmail, TransformFakeName, TransformNull, TransformConstant,
+				TransformKeepLastDigits, TransformFormatPreserving,
+			}, ", "))
+		}
+	}
+
+	return nil
+}
+
+// columns returns the rules of a table by column. qualifier is the schema or database of the table,
+// which rules may omit.
+func (r *Rules) columns(qualifier, table string) map[string]*Rule {
+	var columns map[string]*Rule
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if rule.Table != table && rule.Table != qualifier+"."+table {
+			continue
+		}
+		if columns == nil {
+			columns = make(map[string]*Rule)
+		}
+		columns[rule.Column] = rule
+	}
+	return columns
+}
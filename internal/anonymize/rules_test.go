@@ -0,0 +1,98 @@
+package anonymize
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRules(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	t.Setenv("TEST_MASK_SEED", "from-env")
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "rules.yml",
+			content: `seed: ${TEST_MASK_SEED}
+rules:
+  - table: public.users
+    column: email
+    transform: hash
+    length: 0
+`,
+		},
+		{
+			name: "toml",
+			file: "rules.toml",
+			content: `seed = "${TEST_MASK_SEED}"
+
+[[rules]]
+table = "public.users"
+column = "email"
+transform = "hash"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadRules(writeRules(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadRules() error = %v", err)
+			}
+			if string(rules.key) != "from-env" {
+				t.Errorf("key = %q, want the expanded seed", rules.key)
+			}
+			if rule := rules.columns("public", "users")["email"]; rule == nil || rule.Transform != TransformHash {
+				t.Errorf("columns(public, users) = %v", rules.columns("public", "users"))
+			}
+			if rules.columns("", "users") != nil {
+				t.Error("schema-qualified rule applies to a table of another schema")
+			}
+		})
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "format", file: "rules.json", content: "{}", wantErr: "unsupported file format"},
+		{name: "unknown yaml key", file: "rules.yaml", content: "seed: s\nrule: []\n", wantErr: "not found"},
+		{name: "unknown toml key", file: "rules.toml", content: "seed = \"s\"\nrule = 1\n", wantErr: `unknown key "rule"`},
+		{name: "no seed", file: "rules.yaml", content: "rules:\n  - {table: t, column: c, transform: hash}\n", wantErr: "seed is required"},
+		{name: "unset seed variable", file: "rules.yaml", content: "seed: ${TEST_MASK_UNSET_SEED}\n", wantErr: "seed"},
+		{name: "no rules", file: "rules.yaml", content: "seed: s\n", wantErr: "no rules defined"},
+		{name: "no column", file: "rules.yaml", content: "seed: s\nrules:\n  - {table: t, transform: hash}\n", wantErr: "rule 1: table and column are required"},
+		{name: "unknown transform", file: "rules.yaml", content: "seed: s\nrules:\n  - {table: t, column: c, transform: rot13}\n", wantErr: `unknown transform "rot13"`},
+		{name: "negative length", file: "rules.yaml", content: "seed: s\nrules:\n  - {table: t, column: c, transform: hash, length: -1}\n", wantErr: "between 1 and 64, or 0 for the default of 16"},
+		{name: "long hash", file: "rules.yaml", content: "seed: s\nrules:\n  - {table: t, column: c, transform: hash, length: 65}\n", wantErr: "between 1 and 64"},
+		{name: "negative digits", file: "rules.yaml", content: "seed: s\nrules:\n  - {table: t, column: c, transform: keep_last_digits, digits: -2}\n", wantErr: "digits cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadRules(writeRules(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadRules() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
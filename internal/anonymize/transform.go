@@ -0,0 +1,101 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode"
+)
+
+var (
+	firstNames = []string{
+		"Alex", "Bailey", "Camille", "Dana", "Elliot", "Frankie", "Gabriel", "Harper", "Ines", "Jordan",
+		"Kai", "Lou", "Morgan", "Noa", "Oakley", "Parker", "Quinn", "Robin", "Sacha", "Taylor",
+	}
+	lastNames = []string{
+		"Anders", "Bernard", "Costa", "Dubois", "Evans", "Fischer", "Garcia", "Hansen", "Ivanova", "Jensen",
+		"Kowalski", "Lambert", "Moreau", "Novak", "Olsen", "Petit", "Rossi", "Silva", "Tanaka", "Weber",
+	}
+)
+
+// apply masks value, reporting null when the result is SQL NULL. Values are masked from a keyed
+// hash of the value alone, so equal values get equal masks in every table.
+func (r *Rule) apply(key []byte, value string) (masked string, null bool) {
+	switch r.Transform {
+	case TransformNull:
+		return "", true
+	case TransformConstant:
+		return r.Value, false
+	case TransformHash:
+		length := r.Length
+		if length == 0 {
+			length = defaultHashLength
+		}
+		return hex.EncodeToString(keyedBytes(key, value, (length+1)/2))[:length], false
+	case TransformFakeEmail:
+		return "user_" + hex.EncodeToString(keyedBytes(key, value, 5)) + "@example.com", false
+	case TransformFakeName:
+		b := keyedBytes(key, value, 2)
+		return firstNames[int(b[0])%len(firstNames)] + " " + lastNames[int(b[1])%len(lastNames)], false
+	case TransformKeepLastDigits:
+		return keepLastDigits(key, value, r.Digits), false
+	case TransformFormatPreserving:
+		return preserveFormat(key, value), false
+	default:
+		return value, false
+	}
+}
+
+// keepLastDigits replaces every digit but the last n ones, keeping the other characters
+func keepLastDigits(key []byte, value string, n int) string {
+	runes := []rune(value)
+	digits := 0
+	for _, c := range runes {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+
+	random := keyedBytes(key, value, len(runes))
+	for i, c := range runes {
+		if c < '0' || c > '9' {
+			continue
+		}
+		if digits <= n {
+			break
+		}
+		runes[i] = '0' + rune(random[i]%10)
+		digits--
+	}
+	return string(runes)
+}
+
+// preserveFormat replaces letters with letters of the same case and digits with digits, keeping
+// separators, so that masked values still pass format checks
+func preserveFormat(key []byte, value string) string {
+	runes := []rune(value)
+	random := keyedBytes(key, value, len(runes))
+	for i, c := range runes {
+		switch {
+		case c >= '0' && c <= '9':
+			runes[i] = '0' + rune(random[i]%10)
+		case unicode.IsUpper(c):
+			runes[i] = 'A' + rune(random[i]%26)
+		case unicode.IsLetter(c):
+			runes[i] = 'a' + rune(random[i]%26)
+		}
+	}
+	return string(runes)
+}
+
+// keyedBytes derives n bytes from value with HMAC-SHA256 in counter mode
+func keyedBytes(key []byte, value string, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	for counter := byte(0); len(out) < n; counter++ {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte{counter})
+		mac.Write([]byte(value))
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
@@ -2,21 +2,75 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	SourceConn       string
-	TargetConn       string
-	SourceType       string
-	TargetType       string
-	StdoutMode       bool
-	LogLevel         string
-	BufferSize       int
-	Timeout          time.Duration
-	SkipVerification bool
-	VerifyChunkSize  int
-	SkipTLSVerify    bool
+	SourceConn        string
+	TargetConn        string
+	SourceType        string
+	TargetType        string
+	StdoutMode        bool
+	LogLevel          string
+	LogFormat         string
+	LogFile           string
+	BufferSize        int
+	BufferSpillDir    string
+	Timeout           time.Duration
+	SkipVerification  bool
+	VerifyChunkSize   int
+	SkipTLSVerify     bool
+	AllDatabases      bool
+	DatabaseMap       []string
+	ParallelDatabases int
+	NsInclude         []string
+	NsExclude         []string
+	NsFrom            []string
+	NsTo              []string
+	Overwrite         bool
+	Merge             bool
+	DryRun            bool
+
+	SourcePasswordFile   string
+	TargetPasswordFile   string
+	SourcePasswordSecret string
+	TargetPasswordSecret string
+	VaultAddr            string
+	VaultTokenFile       string
+
+	TLSMode    string
+	SourceCA   string
+	SourceCert string
+	SourceKey  string
+	TargetCA   string
+	TargetCert string
+	TargetKey  string
+
+	SourceSSH     string
+	TargetSSH     string
+	SourceSSHKey  string
+	TargetSSHKey  string
+	SSHKnownHosts string
+
+	NotifyURL      string
+	NotifyTemplate string
+	NotifyRetries  int
+
+	Follow     bool
+	FollowSlot string
+
+	MaskRules string
+	Subset    string
+	Where     []string
+
+	MaxBandwidth string
+
+	SerializableDeferrable bool
+	Snapshot               string
+	ReadPreference         string
+	Oplog                  bool
+	MasterData             bool
 }
 
 func (c *Config) Validate() error {
@@ -28,5 +82,177 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("target type and connection string are required when not using stdout")
 	}
 
+	if c.Timeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("--buffer-size must be positive")
+	}
+
+	if c.VerifyChunkSize <= 0 {
+		return fmt.Errorf("--verify-chunk-size must be positive")
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level %q: expected debug, info, warn or error", c.LogLevel)
+	}
+
+	switch c.LogFormat {
+	case LogFormatConsole, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q: expected console or json", c.LogFormat)
+	}
+
+	switch c.NotifyTemplate {
+	case "json", "slack":
+	default:
+		return fmt.Errorf("invalid notification template %q: expected json or slack", c.NotifyTemplate)
+	}
+
+	if c.NotifyRetries < 0 {
+		return fmt.Errorf("--notify-retries cannot be negative")
+	}
+
+	if c.AllDatabases && c.StdoutMode {
+		return fmt.Errorf("--all-databases cannot be combined with --stdout")
+	}
+
+	if c.Follow && c.StdoutMode {
+		return fmt.Errorf("--follow cannot be combined with --stdout")
+	}
+
+	if c.Follow && c.AllDatabases {
+		return fmt.Errorf("--follow cannot be combined with --all-databases")
+	}
+
+	// Changes would be replicated unmasked
+	if c.MaskRules != "" && c.Follow {
+		return fmt.Errorf("--mask-rules cannot be combined with --follow")
+	}
+
+	if c.Subset != "" {
+		switch {
+		case c.SourceType == "mongodb":
+			return fmt.Errorf("--subset is only supported for PostgreSQL and MySQL")
+		case c.AllDatabases:
+			return fmt.Errorf("--subset cannot be combined with --all-databases")
+		case c.Merge:
+			return fmt.Errorf("--subset cannot be combined with --merge")
+		case c.Follow:
+			return fmt.Errorf("--subset cannot be combined with --follow")
+		}
+	}
+
+	if len(c.Where) > 0 {
+		switch {
+		case c.Subset != "":
+			return fmt.Errorf("--where cannot be combined with --subset")
+		case c.AllDatabases:
+			return fmt.Errorf("--where cannot be combined with --all-databases")
+		case c.Follow:
+			return fmt.Errorf("--where cannot be combined with --follow")
+		}
+	}
+
+	if err := c.validateConsistency(); err != nil {
+		return err
+	}
+
+	if len(c.DatabaseMap) > 0 && !c.AllDatabases {
+		return fmt.Errorf("--database-map requires --all-databases")
+	}
+
+	switch c.TLSMode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("invalid TLS mode %q: expected disable, require, verify-ca or verify-full", c.TLSMode)
+	}
+
+	if c.SkipTLSVerify && strings.HasPrefix(c.TLSMode, "verify-") {
+		return fmt.Errorf("--skip-tls-verify cannot be combined with --tls-mode %s", c.TLSMode)
+	}
+
+	if c.SourceSSHKey != "" && c.SourceSSH == "" {
+		return fmt.Errorf("--source-ssh-key requires --source-ssh")
+	}
+
+	if c.TargetSSHKey != "" && c.TargetSSH == "" {
+		return fmt.Errorf("--target-ssh-key requires --target-ssh")
+	}
+
+	if c.Overwrite && c.Merge {
+		return fmt.Errorf("--overwrite and --merge are mutually exclusive")
+	}
+
+	if c.ParallelDatabases < 0 {
+		return fmt.Errorf("--parallel-databases must not be negative")
+	}
+
+	if len(c.NsInclude)+len(c.NsExclude)+len(c.NsFrom)+len(c.NsTo) > 0 && c.SourceType != "mongodb" {
+		return fmt.Errorf("namespace options (--ns-include, --ns-exclude, --ns-from, --ns-to) are only supported for MongoDB")
+	}
+
+	if len(c.NsFrom) != len(c.NsTo) {
+		return fmt.Errorf("--ns-from and --ns-to must be given the same number of times")
+	}
+
+	if _, err := c.DatabaseMapping(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DatabaseMapping parses the src:dst entries of DatabaseMap into a lookup table
+func (c *Config) DatabaseMapping() (map[string]string, error) {
+	mapping := make(map[string]string, len(c.DatabaseMap))
+	for _, entry := range c.DatabaseMap {
+		src, dst, ok := strings.Cut(entry, ":")
+		if !ok || src == "" || dst == "" {
+			return nil, fmt.Errorf("invalid database mapping %q: expected src:dst", entry)
+		}
+		if _, exists := mapping[src]; exists {
+			return nil, fmt.Errorf("database %q is mapped more than once", src)
+		}
+		mapping[src] = dst
+	}
+	return mapping, nil
+}
+
+// validateConsistency checks the options of a consistent read from the source against its type
+func (c *Config) validateConsistency() error {
+	if (c.SerializableDeferrable || c.Snapshot != "") && c.SourceType != "postgres" {
+		return fmt.Errorf("--serializable-deferrable and --snapshot are only supported for PostgreSQL")
+	}
+	// A snapshot belongs to a single database, and pg_dump reads it in its own isolation level
+	if c.Snapshot != "" && (c.AllDatabases || c.SerializableDeferrable) {
+		return fmt.Errorf("--snapshot cannot be combined with --all-databases or --serializable-deferrable")
+	}
+
+	if (c.ReadPreference != "" || c.Oplog) && c.SourceType != "mongodb" {
+		return fmt.Errorf("--read-preference and --oplog are only supported for MongoDB")
+	}
+	switch c.ReadPreference {
+	case "", "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest":
+	default:
+		if !strings.HasPrefix(strings.TrimSpace(c.ReadPreference), "{") {
+			return fmt.Errorf("invalid read preference %q: expected primary, primaryPreferred, secondary, secondaryPreferred, nearest or a JSON document", c.ReadPreference)
+		}
+	}
+	if c.Oplog && (c.AllDatabases || len(c.Where) > 0) {
+		return fmt.Errorf("--oplog cannot be combined with --all-databases or --where")
+	}
+
+	if c.MasterData {
+		switch {
+		case c.SourceType != "mysql":
+			return fmt.Errorf("--master-data is only supported for MySQL")
+		case c.Subset != "" || len(c.Where) > 0:
+			return fmt.Errorf("--master-data cannot be combined with --subset or --where")
+		}
+	}
 	return nil
 }
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a configuration file holding shared settings and named profiles.
+// Every setting is keyed by the name of the command-line flag it stands for.
+type File struct {
+	Path           string
+	Settings       map[string]interface{}
+	DefaultProfile string
+	Profiles       map[string]map[string]interface{}
+}
+
+// LoadFile reads a YAML (.yaml, .yml) or TOML (.toml) configuration file
+func LoadFile(path string) (*File, error) {
+	raw, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Path:     path,
+		Settings: make(map[string]interface{}),
+		Profiles: make(map[string]map[string]interface{}),
+	}
+
+	for key, value := range raw {
+		switch key {
+		case "default_profile":
+			name, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: default_profile must be a string", path)
+			}
+			f.DefaultProfile = name
+		case "profiles":
+			profiles, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: profiles must be a mapping of profile names to settings", path)
+			}
+			for name, settings := range profiles {
+				profile, ok := settings.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: profile %q must be a mapping of settings", path, name)
+				}
+				f.Profiles[name] = profile
+			}
+		default:
+			f.Settings[key] = value
+		}
+	}
+
+	if f.DefaultProfile != "" {
+		if _, ok := f.Profiles[f.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("%s: default_profile %q is not defined", path, f.DefaultProfile)
+		}
+	}
+
+	return f, nil
+}
+
+// decodeFile parses a YAML or TOML file, picked by extension, into a generic mapping
+func decodeFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported file format %q: expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return raw, nil
+}
+
+// ProfileNames returns the names of the profiles defined in the file
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the settings of the named profile layered over the shared settings, with
+// environment variables interpolated. An empty name selects default_profile, or the only
+// profile of the file when there is just one.
+func (f *File) Resolve(name string) (map[string][]string, error) {
+	if name == "" {
+		switch {
+		case f.DefaultProfile != "":
+			name = f.DefaultProfile
+		case len(f.Profiles) == 1:
+			name = f.ProfileNames()[0]
+		case len(f.Profiles) > 1:
+			return nil, fmt.Errorf("%s defines several profiles (%s), select one with --profile",
+				f.Path, strings.Join(f.ProfileNames(), ", "))
+		}
+	}
+
+	merged := make(map[string]interface{}, len(f.Settings))
+	for key, value := range f.Settings {
+		merged[key] = value
+	}
+
+	if name != "" {
+		profile, ok := f.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not defined in %s", name, f.Path)
+		}
+		for key, value := range profile {
+			merged[key] = value
+		}
+	}
+
+	return resolveSettings(f.Path, merged)
+}
+
+// resolveSettings flattens raw settings into string values and interpolates environment variables
+func resolveSettings(path string, raw map[string]interface{}) (map[string][]string, error) {
+	settings := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		values, err := settingValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: setting %q: %w", path, key, err)
+		}
+		for i, v := range values {
+			if values[i], err = ExpandEnv(v); err != nil {
+				return nil, fmt.Errorf("%s: setting %q: %w", path, key, err)
+			}
+		}
+		settings[key] = values
+	}
+
+	return settings, nil
+}
+
+// settingValues flattens a scalar or list setting into its string values
+func settingValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("nested lists and mappings are not supported")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("mappings are not supported, use the flag name as key")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+var envPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandEnv replaces ${VAR} and ${VAR:-default} with the value of the environment variable.
+// '$$' produces a literal '$'. Referencing an unset variable without default is an error.
+func ExpandEnv(value string) (string, error) {
+	var missing []string
+
+	expanded := envPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		groups := envPattern.FindStringSubmatch(match)
+		if v, ok := os.LookupEnv(groups[1]); ok {
+			return v
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+
+		missing = append(missing, groups[1])
+		return ""
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
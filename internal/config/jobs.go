@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Job is one source/target pair of a batch, described by flag-name settings
+type Job struct {
+	Name     string
+	Settings map[string][]string
+}
+
+// JobsFile lists the jobs of a batch and the defaults they share
+type JobsFile struct {
+	Defaults map[string][]string
+	Jobs     []Job
+}
+
+// LoadJobs reads a YAML or TOML batch file made of a `defaults` mapping and a `jobs` list.
+// Job names default to job-<n> and must be unique.
+func LoadJobs(path string) (*JobsFile, error) {
+	raw, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jobsFile := &JobsFile{Defaults: make(map[string][]string)}
+
+	for key := range raw {
+		if key != "defaults" && key != "jobs" {
+			return nil, fmt.Errorf("%s: unknown key %q, expected defaults and jobs", path, key)
+		}
+	}
+
+	if defaults, ok := raw["defaults"]; ok {
+		settings, ok := defaults.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: defaults must be a mapping of settings", path)
+		}
+		if jobsFile.Defaults, err = resolveSettings(path, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	// TOML decodes arrays of tables as []map[string]interface{}, YAML as []interface{}
+	var entries []map[string]interface{}
+	switch jobs := raw["jobs"].(type) {
+	case []map[string]interface{}:
+		entries = jobs
+	case []interface{}:
+		for i, job := range jobs {
+			entry, ok := job.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: job #%d must be a mapping of settings", path, i+1)
+			}
+			entries = append(entries, entry)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("%s: jobs must be a list", path)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no jobs defined", path)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		name := fmt.Sprintf("job-%d", i+1)
+		if value, ok := entry["name"]; ok {
+			if name, ok = value.(string); !ok || name == "" {
+				return nil, fmt.Errorf("%s: job #%d has an invalid name", path, i+1)
+			}
+			delete(entry, "name")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s: job name %q is used more than once", path, name)
+		}
+		seen[name] = true
+
+		settings, err := resolveSettings(path, entry)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", name, err)
+		}
+		jobsFile.Jobs = append(jobsFile.Jobs, Job{Name: name, Settings: settings})
+	}
+
+	return jobsFile, nil
+}
@@ -3,11 +3,21 @@ package config
 import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"os"
 )
 
+// Log formats
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
 type LoggerOptions struct {
-	ForceStderr bool
+	// Format is console (the default) or json
+	Format string
+	// Output receives every log entry, stderr when nil so that stdout stays free for dumps
+	Output io.Writer
 }
 
 func NewLogger(level string, opts LoggerOptions) *Logger {
@@ -21,42 +31,71 @@ func NewLogger(level string, opts LoggerOptions) *Logger {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	// Create core
-	var core zapcore.Core
-	if opts.ForceStderr {
-		// Force all output to stderr when in stdout mode
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(encoderConfig),
-			zapcore.Lock(os.Stderr),
-			zapLevel,
-		)
+	var encoder zapcore.Encoder
+	if opts.Format == LogFormatJSON {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
 	} else {
-		// Normal configuration with both stdout and stderr
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(encoderConfig),
-			zapcore.NewMultiWriteSyncer(
-				zapcore.Lock(os.Stdout),
-				zapcore.Lock(os.Stderr),
-			),
-			zapLevel,
-		)
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+
+	var output io.Writer = os.Stderr
+	if opts.Output != nil {
+		output = opts.Output
 	}
 
 	// Create logger
+	core := zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(output)), zapLevel)
 	logger := zap.New(core)
 	return &Logger{
 		logger: logger.Sugar(),
 	}
 }
 
+// NewNopLogger returns a logger discarding every entry
+func NewNopLogger() *Logger {
+	return &Logger{logger: zap.NewNop().Sugar()}
+}
+
 // Logger wraps zap.SugaredLogger
 type Logger struct {
 	logger *zap.SugaredLogger
 }
 
+// With returns a logger that adds the given key-value pairs to every entry
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{logger: l.logger.With(args...)}
+}
+
+// Sync flushes buffered log entries
+func (l *Logger) Sync() error {
+	return l.logger.Sync()
+}
+
+func (l *Logger) Debug(args ...interface{})                   { l.logger.Debug(args...) }
+func (l *Logger) Debugf(template string, args ...interface{}) { l.logger.Debugf(template, args...) }
 func (l *Logger) Info(args ...interface{})                    { l.logger.Info(args...) }
 func (l *Logger) Infof(template string, args ...interface{})  { l.logger.Infof(template, args...) }
 func (l *Logger) Warn(args ...interface{})                    { l.logger.Warn(args...) }
 func (l *Logger) Warnf(template string, args ...interface{})  { l.logger.Warnf(template, args...) }
 func (l *Logger) Error(args ...interface{})                   { l.logger.Error(args...) }
 func (l *Logger) Errorf(template string, args ...interface{}) { l.logger.Errorf(template, args...) }
+
+// Debugw logs a message with the given key-value pairs
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.logger.Debugw(msg, keysAndValues...)
+}
+
+// Infow logs a message with the given key-value pairs
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logger.Infow(msg, keysAndValues...)
+}
+
+// Warnw logs a message with the given key-value pairs
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.logger.Warnw(msg, keysAndValues...)
+}
+
+// Errorw logs a message with the given key-value pairs
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logger.Errorw(msg, keysAndValues...)
+}
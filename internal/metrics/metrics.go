@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Migration phases
+const (
+	PhaseInspecting = "inspecting"
+	PhaseMigrating  = "migrating"
+	PhaseVerifying  = "verifying"
+	PhaseFollowing  = "following"
+)
+
+// Error classes
+const (
+	ErrorConnection     = "connection"
+	ErrorTargetNotEmpty = "target_not_empty"
+	ErrorDump           = "dump"
+	ErrorRestore        = "restore"
+	ErrorMismatch       = "verification_mismatch"
+	ErrorVerification   = "verification"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	bytesDumped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "migrationdb_dumped_bytes_total",
+		Help: "Bytes produced by the source dump tools.",
+	})
+	bytesRestored = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "migrationdb_restored_bytes_total",
+		Help: "Bytes consumed by the target restore tools.",
+	})
+	phase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "migrationdb_phase",
+		Help: "Number of migrations currently in each phase.",
+	}, []string{"phase"})
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "migrationdb_phase_duration_seconds",
+		Help:    "Duration of the migration phases.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"phase"})
+	tables = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "migrationdb_table_dumped",
+		Help: "Tables and collections seen by the dump tools: 0 while dumping, 1 once done.",
+	}, []string{"table"})
+	tablesCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "migrationdb_tables_completed_total",
+		Help: "Tables and collections fully dumped.",
+	})
+	verificationChunks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "migrationdb_verification_chunks_total",
+		Help: "Verification chunks compared, by result.",
+	}, []string{"result"})
+	verificationBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "migrationdb_verification_bytes_total",
+		Help: "Bytes of source dump compared during verification.",
+	})
+	replicationLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "migrationdb_replication_lag_seconds",
+		Help: "Age of the last source change applied to the target in --follow mode.",
+	})
+	changesApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "migrationdb_replication_changes_total",
+		Help: "Source changes applied to the target in --follow mode.",
+	})
+	bandwidthLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "migrationdb_bandwidth_limit_bytes_per_second",
+		Help: "Limit of the migration stream set by --max-bandwidth, 0 when unlimited.",
+	})
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "migrationdb_errors_total",
+		Help: "Errors, by class.",
+	}, []string{"class"})
+)
+
+func init() {
+	registry.MustRegister(
+		bytesDumped, bytesRestored, phase, phaseDuration, tables, tablesCompleted,
+		verificationChunks, verificationBytes, replicationLag, changesApplied, bandwidthLimit, errorsTotal,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// StartPhase counts a migration as being in the named phase and returns the function ending it,
+// which records the phase duration
+func StartPhase(name string) func() {
+	start := time.Now()
+	phase.WithLabelValues(name).Inc()
+
+	return func() {
+		phase.WithLabelValues(name).Dec()
+		phaseDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+}
+
+// AddDumped records bytes produced by a dump
+func AddDumped(n int) {
+	bytesDumped.Add(float64(n))
+}
+
+// AddRestored records bytes consumed by a restore
+func AddRestored(n int) {
+	bytesRestored.Add(float64(n))
+}
+
+// TableStarted records that the dump of a table or collection began
+func TableStarted(table string) {
+	tables.WithLabelValues(table).Set(0)
+}
+
+// TableDone records that the dump of a table or collection finished
+func TableDone(table string) {
+	tables.WithLabelValues(table).Set(1)
+	tablesCompleted.Inc()
+}
+
+// ChunkCompared records the result of a verification chunk comparison
+func ChunkCompared(bytes int, match bool) {
+	result := "match"
+	if !match {
+		result = "mismatch"
+	}
+	verificationChunks.WithLabelValues(result).Inc()
+	verificationBytes.Add(float64(bytes))
+}
+
+// ReplicationLag records the lag of the changes applied in --follow mode
+func ReplicationLag(lag time.Duration) {
+	replicationLag.Set(lag.Seconds())
+}
+
+// ChangesApplied records source changes applied in --follow mode
+func ChangesApplied(n int64) {
+	changesApplied.Add(float64(n))
+}
+
+// BandwidthLimit records the current limit of the migration stream
+func BandwidthLimit(rate int64) {
+	bandwidthLimit.Set(float64(rate))
+}
+
+// RecordError counts an error of the given class
+func RecordError(class string) {
+	errorsTotal.WithLabelValues(class).Inc()
+}
+
+// handlers are the endpoints served next to the metrics
+var handlers = make(map[string]http.Handler)
+
+// Handle serves handler on pattern next to the metrics; call it before Serve
+func Handle(pattern string, handler http.Handler) {
+	handlers[pattern] = handler
+}
+
+// Serve exposes the metrics on http://addr/metrics, and the endpoints added with Handle, until the
+// returned function is called
+func Serve(addr string) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: newHandler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "metrics server stopped: %v\n", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+// newHandler routes /metrics and the endpoints added with Handle
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
+	return mux
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics = %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	}))
+	t.Cleanup(func() { delete(handlers, "/ping") })
+
+	server := httptest.NewServer(newHandler())
+	defer server.Close()
+
+	endMigrating := StartPhase(PhaseMigrating)
+	AddDumped(1500)
+	AddRestored(1200)
+	TableStarted("public.orders")
+	TableStarted("public.users")
+	TableDone("public.users")
+	ChunkCompared(512, true)
+	ChunkCompared(256, false)
+	BandwidthLimit(10 << 20)
+	RecordError(ErrorRestore)
+
+	during := scrape(t, server)
+	for _, want := range []string{
+		`migrationdb_phase{phase="migrating"} 1`,
+		"migrationdb_dumped_bytes_total 1500",
+		"migrationdb_restored_bytes_total 1200",
+		`migrationdb_table_dumped{table="public.orders"} 0`,
+		`migrationdb_table_dumped{table="public.users"} 1`,
+		"migrationdb_tables_completed_total 1",
+		`migrationdb_verification_chunks_total{result="match"} 1`,
+		`migrationdb_verification_chunks_total{result="mismatch"} 1`,
+		"migrationdb_verification_bytes_total 768",
+		"migrationdb_bandwidth_limit_bytes_per_second 1.048576e+07",
+		`migrationdb_errors_total{class="restore"} 1`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(during, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+
+	endMigrating()
+	after := scrape(t, server)
+	for _, want := range []string{
+		`migrationdb_phase{phase="migrating"} 0`,
+		`migrationdb_phase_duration_seconds_count{phase="migrating"} 1`,
+	} {
+		if !strings.Contains(after, want+"\n") {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "pong" {
+		t.Errorf("GET /ping = %q, want pong", body)
+	}
+}
@@ -0,0 +1,182 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// streamBuffer is a pipe holding up to size bytes in memory between the dump and the restore, so that
+// neither side stalls when the other is momentarily slow. With a spill file, writes that do not fit
+// go to disk instead of blocking, and are read back in order once the memory is drained.
+type streamBuffer struct {
+	mu       sync.Mutex
+	readable sync.Cond
+	writable sync.Cond
+
+	ring  []byte
+	start int
+	n     int
+
+	spill      *os.File
+	spillRead  int64
+	spillWrite int64
+
+	// Errors returned to the reader once drained, and to the writer
+	writeErr error
+	readErr  error
+}
+
+// bufferLevel is the content of a streamBuffer
+type bufferLevel struct {
+	Memory  int
+	Size    int
+	Spilled int64
+}
+
+// newStreamBuffer returns a buffer of size bytes of memory, spilling over to a temporary file of
+// spillDir when set
+func newStreamBuffer(size int, spillDir string) (*streamBuffer, error) {
+	b := &streamBuffer{ring: make([]byte, size)}
+	b.readable.L = &b.mu
+	b.writable.L = &b.mu
+
+	if spillDir != "" {
+		f, err := os.CreateTemp(spillDir, "migrationdb-spill-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create buffer spill file: %w", err)
+		}
+		b.spill = f
+	}
+	return b, nil
+}
+
+// Write blocks until p fits in memory or the spill file, or the reader is closed
+func (b *streamBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		if b.readErr != nil {
+			return written, b.readErr
+		}
+		if b.writeErr != nil {
+			return written, io.ErrClosedPipe
+		}
+
+		// Once spilled, data goes to disk until the reader catches up, to stay in order
+		if b.spill != nil && (b.n == len(b.ring) || b.spillWrite > b.spillRead) {
+			n, err := b.spill.WriteAt(p, b.spillWrite)
+			b.spillWrite += int64(n)
+			written += n
+			b.readable.Signal()
+			if err != nil {
+				return written, fmt.Errorf("failed to write buffer spill file: %w", err)
+			}
+			return written, nil
+		}
+
+		if b.n == len(b.ring) {
+			b.writable.Wait()
+			continue
+		}
+
+		end := (b.start + b.n) % len(b.ring)
+		limit := len(b.ring)
+		if end < b.start {
+			limit = b.start
+		}
+		n := copy(b.ring[end:limit], p)
+		if end >= b.start && n == limit-end && b.start > 0 {
+			n += copy(b.ring[:b.start], p[n:])
+		}
+		b.n += n
+		written += n
+		p = p[n:]
+		b.readable.Signal()
+	}
+	return written, nil
+}
+
+// Read blocks until data is buffered or the writer is closed
+func (b *streamBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		if b.readErr != nil {
+			return 0, io.ErrClosedPipe
+		}
+		if b.n > 0 {
+			limit := min(b.start+b.n, len(b.ring))
+			n := copy(p, b.ring[b.start:limit])
+			b.start = (b.start + n) % len(b.ring)
+			b.n -= n
+			b.writable.Signal()
+			return n, nil
+		}
+		if b.spillRead < b.spillWrite {
+			n, err := b.spill.ReadAt(p[:min(int64(len(p)), b.spillWrite-b.spillRead)], b.spillRead)
+			b.spillRead += int64(n)
+			if b.spillRead == b.spillWrite {
+				// Drained: the next writes go to memory, and the file starts over
+				b.spillRead, b.spillWrite = 0, 0
+				b.spill.Truncate(0)
+				b.writable.Signal()
+			}
+			if err != nil && err != io.EOF {
+				return n, fmt.Errorf("failed to read buffer spill file: %w", err)
+			}
+			return n, nil
+		}
+		if b.writeErr != nil {
+			return 0, b.writeErr
+		}
+		b.readable.Wait()
+	}
+}
+
+// CloseWrite ends the data the reader gets: once drained, reads return err, or io.EOF when nil
+func (b *streamBuffer) CloseWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.writeErr == nil {
+		b.writeErr = err
+	}
+	b.readable.Broadcast()
+}
+
+// CloseRead makes pending and later writes fail with err, or io.ErrClosedPipe when nil, and removes
+// the spill file
+func (b *streamBuffer) CloseRead(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.readErr == nil {
+		b.readErr = err
+	}
+	if b.spill != nil {
+		b.spill.Close()
+		os.Remove(b.spill.Name())
+		b.spill = nil
+		b.spillRead, b.spillWrite = 0, 0
+	}
+	b.writable.Broadcast()
+	b.readable.Broadcast()
+}
+
+// Level returns the bytes waiting in memory and on disk
+func (b *streamBuffer) Level() bufferLevel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bufferLevel{Memory: b.n, Size: len(b.ring), Spilled: b.spillWrite - b.spillRead}
+}
@@ -0,0 +1,222 @@
+package migration
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestBuffer(t *testing.T, size int, spill bool) *streamBuffer {
+	t.Helper()
+	dir := ""
+	if spill {
+		dir = t.TempDir()
+	}
+	b, err := newStreamBuffer(size, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.CloseRead(nil) })
+	return b
+}
+
+func mustWrite(t *testing.T, b *streamBuffer, s string) {
+	t.Helper()
+	if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+		t.Fatalf("Write(%q) = %d, %v", s, n, err)
+	}
+}
+
+func mustRead(t *testing.T, b *streamBuffer, size int, want string) {
+	t.Helper()
+	p := make([]byte, size)
+	n, err := b.Read(p)
+	if err != nil || string(p[:n]) != want {
+		t.Fatalf("Read() = %q, %v, want %q", p[:n], err, want)
+	}
+}
+
+func checkLevel(t *testing.T, b *streamBuffer, memory int, spilled int64) {
+	t.Helper()
+	if level := b.Level(); level.Memory != memory || level.Spilled != spilled {
+		t.Fatalf("Level() = %+v, want %d in memory and %d spilled", level, memory, spilled)
+	}
+}
+
+func TestStreamBufferWrapAround(t *testing.T) {
+	b := newTestBuffer(t, 8, false)
+
+	mustWrite(t, b, "abcdef")
+	mustRead(t, b, 4, "abcd")
+	// Fills the end of the ring, then wraps to its start
+	mustWrite(t, b, "ghijkl")
+	checkLevel(t, b, 8, 0)
+
+	// Reads stop at the end of the ring
+	mustRead(t, b, 16, "efgh")
+	mustRead(t, b, 16, "ijkl")
+	checkLevel(t, b, 0, 0)
+
+	// Writes into a wrapped ring fill the gap before its start
+	mustWrite(t, b, "mnop")
+	mustRead(t, b, 2, "mn")
+	mustWrite(t, b, "qrstuv")
+	mustRead(t, b, 16, "op")
+	mustRead(t, b, 16, "qrstuv")
+}
+
+func TestStreamBufferBlocksWhenFull(t *testing.T) {
+	b := newTestBuffer(t, 4, false)
+	mustWrite(t, b, "abcd")
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := b.Write([]byte("efgh"))
+		written <- err
+	}()
+	select {
+	case <-written:
+		t.Fatal("Write() to a full buffer returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mustRead(t, b, 2, "ab")
+	mustRead(t, b, 2, "cd")
+	if err := <-written; err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	mustRead(t, b, 4, "efgh")
+}
+
+func TestStreamBufferSpill(t *testing.T) {
+	b := newTestBuffer(t, 4, true)
+
+	// What does not fit goes to disk without blocking
+	mustWrite(t, b, "abcdef")
+	checkLevel(t, b, 4, 2)
+
+	// Writes keep going to disk until it is drained, even once memory is free
+	mustRead(t, b, 2, "ab")
+	mustWrite(t, b, "gh")
+	checkLevel(t, b, 2, 4)
+
+	// Memory is read first, then the disk in order
+	mustRead(t, b, 16, "cd")
+	mustRead(t, b, 3, "efg")
+	mustWrite(t, b, "ij")
+	mustRead(t, b, 16, "hij")
+	checkLevel(t, b, 0, 0)
+
+	// Once drained, the file starts over and writes go to memory again
+	info, err := b.spill.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("drained spill file holds %d bytes", info.Size())
+	}
+	mustWrite(t, b, "kl")
+	checkLevel(t, b, 2, 0)
+	mustRead(t, b, 16, "kl")
+}
+
+func TestStreamBufferClose(t *testing.T) {
+	b := newTestBuffer(t, 4, false)
+	mustWrite(t, b, "ab")
+	failure := errors.New("dump failed")
+	b.CloseWrite(failure)
+
+	// Buffered data is read before the error
+	mustRead(t, b, 16, "ab")
+	if _, err := b.Read(make([]byte, 16)); !errors.Is(err, failure) {
+		t.Errorf("Read() error = %v, want %v", err, failure)
+	}
+	if _, err := b.Write([]byte("c")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write() after CloseWrite error = %v, want %v", err, io.ErrClosedPipe)
+	}
+
+	b = newTestBuffer(t, 4, false)
+	b.CloseWrite(nil)
+	if _, err := b.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestStreamBufferCloseRead(t *testing.T) {
+	b := newTestBuffer(t, 4, true)
+	mustWrite(t, b, "abcdef")
+	spill := b.spill.Name()
+
+	failure := errors.New("restore failed")
+	b.CloseRead(failure)
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("spill file kept after CloseRead: %v", err)
+	}
+	if _, err := b.Write([]byte("g")); !errors.Is(err, failure) {
+		t.Errorf("Write() error = %v, want %v", err, failure)
+	}
+	if _, err := b.Read(make([]byte, 16)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Read() error = %v, want %v", err, io.ErrClosedPipe)
+	}
+
+	// A writer blocked on a full buffer is released
+	b = newTestBuffer(t, 4, false)
+	mustWrite(t, b, "abcd")
+	written := make(chan error, 1)
+	go func() {
+		_, err := b.Write([]byte("e"))
+		written <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	b.CloseRead(nil)
+	select {
+	case err := <-written:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("Write() error = %v, want %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked Write() was not released by CloseRead")
+	}
+}
+
+func TestStreamBufferOrder(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, spill := range []bool{false, true} {
+		b := newTestBuffer(t, 4096+7, spill)
+		go func() {
+			random := rand.New(rand.NewSource(2))
+			for p := data; len(p) > 0; {
+				n := min(len(p), 1+random.Intn(10000))
+				if _, err := b.Write(p[:n]); err != nil {
+					b.CloseWrite(err)
+					return
+				}
+				p = p[n:]
+			}
+			b.CloseWrite(nil)
+		}()
+
+		var got bytes.Buffer
+		random := rand.New(rand.NewSource(3))
+		for {
+			p := make([]byte, 1+random.Intn(9000))
+			n, err := b.Read(p)
+			got.Write(p[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			t.Errorf("spill %v: read data differs from written data (%d of %d bytes)", spill, got.Len(), len(data))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// SourcePosition is the point of the source replication log a dump is consistent with
+type SourcePosition struct {
+	// BinlogFile and BinlogPos locate the MySQL binlog position, as in CHANGE REPLICATION SOURCE TO
+	BinlogFile string
+	BinlogPos  int64
+	// GTIDSet holds the transactions of the dump when GTIDs are enabled on the source
+	GTIDSet string
+}
+
+// IsZero reports whether no position was recorded
+func (p SourcePosition) IsZero() bool {
+	return p.BinlogFile == "" && p.GTIDSet == ""
+}
+
+// String renders the binlog position as file:offset, the form cutover --position reads
+func (p SourcePosition) String() string {
+	if p.BinlogFile == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", p.BinlogFile, p.BinlogPos)
+}
+
+// PositionDumper is implemented by dumpers recording the source position of their last dump
+type PositionDumper interface {
+	SourcePosition() SourcePosition
+}
+
+// PostgresSnapshot keeps a PostgreSQL snapshot exported until Close, so that dumps of the same
+// database read the same data with WithSnapshot
+type PostgresSnapshot struct {
+	ID string
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// ExportPostgresSnapshot exports a snapshot of the database of connString, taken in a SERIALIZABLE
+// DEFERRABLE transaction when serializableDeferrable is set
+func ExportPostgresSnapshot(ctx context.Context, connString string, serializableDeferrable bool) (*PostgresSnapshot, error) {
+	db, tx, id, err := beginPostgresSnapshotTx(ctx, connString, serializableDeferrable, "")
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresSnapshot{ID: id, db: db, tx: tx}, nil
+}
+
+// Close ends the transaction of the snapshot; dumps can no longer import it
+func (s *PostgresSnapshot) Close() error {
+	s.tx.Rollback()
+	return s.db.Close()
+}
+
+// beginPostgresSnapshotTx starts a read-only transaction and returns its snapshot: the imported
+// snapshot when set, else a newly exported one. pg_dump imports snapshots in REPEATABLE READ, which
+// accepts the snapshot of a SERIALIZABLE transaction.
+func beginPostgresSnapshotTx(ctx context.Context, connString string, serializableDeferrable bool, snapshot string) (*sql.DB, *sql.Tx, string, error) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create database connection: %w", err)
+	}
+
+	fail := func(tx *sql.Tx, format string, err error) (*sql.DB, *sql.Tx, string, error) {
+		if tx != nil {
+			tx.Rollback()
+		}
+		db.Close()
+		return nil, nil, "", fmt.Errorf(format, err)
+	}
+
+	// database/sql has no DEFERRABLE option, so the isolation is set by the first statement
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(nil, "failed to start transaction: %w", err)
+	}
+	isolation := "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"
+	if serializableDeferrable && snapshot == "" {
+		// Waits until no concurrent transaction can make the snapshot inconsistent
+		isolation = "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY, DEFERRABLE"
+	}
+	if _, err := tx.ExecContext(ctx, isolation); err != nil {
+		return fail(tx, "failed to start transaction: %w", err)
+	}
+
+	if snapshot != "" {
+		if _, err := tx.ExecContext(ctx, "SET TRANSACTION SNAPSHOT "+pq.QuoteLiteral(snapshot)); err != nil {
+			return fail(tx, "failed to import snapshot: %w", err)
+		}
+		return db, tx, snapshot, nil
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		return fail(tx, "failed to export snapshot: %w", err)
+	}
+	return db, tx, snapshot, nil
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Placeholder shown in place of the temporary files holding credentials
+const credentialsFilePlaceholder = "<temporary credentials file>"
+
+// splitPassword removes the password from a URL connection string and returns it separately,
+// so that it can be handed to a subprocess without appearing on its command line
+func splitPassword(connString string) (string, string) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return connString, ""
+	}
+
+	// libpq also accepts the password as a query parameter
+	query := u.Query()
+	password := query.Get("password")
+	if query.Has("password") {
+		query.Del("password")
+		u.RawQuery = query.Encode()
+	}
+
+	if u.User != nil {
+		if userPassword, ok := u.User.Password(); ok {
+			password = userPassword
+			u.User = url.User(u.User.Username())
+		}
+	}
+
+	if password == "" {
+		return connString, ""
+	}
+	return u.String(), password
+}
+
+// commandEnv returns the environment of a subprocess receiving value through the variable key.
+// A nil environment makes the subprocess inherit the current one.
+func commandEnv(key, value string) []string {
+	if value == "" {
+		return nil
+	}
+	return append(os.Environ(), key+"="+value)
+}
+
+// writeCredentialsFile writes content to a new temporary file readable by the current user only.
+// The returned function removes the file and must be called once the subprocess exits.
+func writeCredentialsFile(pattern, content string) (string, func(), error) {
+	// CreateTemp creates the file with mode 0600
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create credentials file: %w", err)
+	}
+	remove := func() { os.Remove(file.Name()) }
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		remove()
+		return "", nil, fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("failed to write credentials file: %w", err)
+	}
+
+	return file.Name(), remove, nil
+}
@@ -0,0 +1,326 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// systemDatabases lists the databases owned by the server itself, which are never migrated
+var systemDatabases = map[DatabaseType]map[string]bool{
+	Postgres: {
+		"postgres":          true,
+		"rdsadmin":          true,
+		"azure_maintenance": true,
+		"azure_sys":         true,
+		"cloudsqladmin":     true,
+	},
+	MySQL: {
+		"information_schema": true,
+		"mysql":              true,
+		"performance_schema": true,
+		"sys":                true,
+	},
+	MongoDB: {
+		"admin":  true,
+		"config": true,
+		"local":  true,
+	},
+}
+
+// ListDatabases returns the user databases found on the server behind connString
+func ListDatabases(ctx context.Context, dbType string, connString string) ([]string, error) {
+	var names []string
+	var err error
+
+	switch DatabaseType(dbType) {
+	case Postgres:
+		names, err = querySQLDatabases(ctx, "postgres", connString,
+			"SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn")
+	case MySQL:
+		dsn, dsnErr := MySQLDSN(connString)
+		if dsnErr != nil {
+			return nil, dsnErr
+		}
+		names, err = querySQLDatabases(ctx, "mysql", dsn, "SHOW DATABASES")
+	case MongoDB:
+		names, err = listMongoDatabases(ctx, connString)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	system := systemDatabases[DatabaseType(dbType)]
+	userDatabases := make([]string, 0, len(names))
+	for _, name := range names {
+		if !system[name] {
+			userDatabases = append(userDatabases, name)
+		}
+	}
+	sort.Strings(userDatabases)
+
+	return userDatabases, nil
+}
+
+func querySQLDatabases(ctx context.Context, driver, dsn, query string) ([]string, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read database name: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func listMongoDatabases(ctx context.Context, connString string) ([]string, error) {
+	client, err := mongo.Connect(ctx, MongoClientOptions(connString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	names, err := client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	return names, nil
+}
+
+// DatabaseExists reports whether the named database exists on the server behind connString.
+// MongoDB creates databases implicitly on first write, so they always count as existing.
+func DatabaseExists(ctx context.Context, dbType string, connString string, name string) (bool, error) {
+	var driver, dsn, query string
+
+	switch DatabaseType(dbType) {
+	case Postgres:
+		driver, dsn = "postgres", connString
+		query = "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)"
+	case MySQL:
+		var err error
+		if dsn, err = MySQLDSN(connString); err != nil {
+			return false, err
+		}
+		driver = "mysql"
+		query = "SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?)"
+	case MongoDB:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return false, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, query, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check database %s: %w", name, err)
+	}
+
+	return exists, nil
+}
+
+// EnsureDatabase creates the named database on the target server when it does not exist yet
+func EnsureDatabase(ctx context.Context, dbType string, connString string, name string) error {
+	exists, err := DatabaseExists(ctx, dbType, connString, name)
+	if err != nil || exists {
+		return err
+	}
+
+	var driver, dsn, statement string
+	switch DatabaseType(dbType) {
+	case Postgres:
+		// CREATE DATABASE does not accept bind parameters
+		driver, dsn = "postgres", connString
+		statement = "CREATE DATABASE " + quotePostgresIdentifier(name)
+	case MySQL:
+		if dsn, err = MySQLDSN(connString); err != nil {
+			return err
+		}
+		driver = "mysql"
+		statement = "CREATE DATABASE IF NOT EXISTS " + quoteMySQLIdentifier(name)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// DatabaseName returns the database named in the path of a connection string
+func DatabaseName(connString string) (string, error) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+	return strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// ReplaceDatabase returns connString pointing at the named database
+func ReplaceDatabase(connString string, name string) (string, error) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	// MongoDB authenticates against the database in the path unless authSource is set,
+	// so pin it to the original one before swapping the path out
+	if (u.Scheme == "mongodb" || u.Scheme == "mongodb+srv") && u.User != nil {
+		query := u.Query()
+		if query.Get("authSource") == "" {
+			authSource := strings.TrimPrefix(u.Path, "/")
+			if authSource == "" {
+				authSource = "admin"
+			}
+			query.Set("authSource", authSource)
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	u.Path = "/" + name
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// defaultPorts are the server ports assumed when a connection string has none
+var defaultPorts = map[DatabaseType]string{
+	Postgres: "5432",
+	MySQL:    "3306",
+	MongoDB:  "27017",
+}
+
+// ServerAddress returns the host:port of the single server behind a URL connection string
+func ServerAddress(dbType string, connString string) (string, error) {
+	u, err := parseServerURL(dbType, connString)
+	if err != nil {
+		return "", err
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = defaultPorts[DatabaseType(dbType)]
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// ReplaceServerAddress returns connString pointing at addr instead of its server. MongoDB
+// connections are made direct, as the other replica set members are not reachable through addr.
+// Certificates checked against the host name keep being checked against the original one where the
+// client allows it, see mysqlConn.tlsServerName and MongoClientOptions; libpq does not.
+func ReplaceServerAddress(dbType string, connString string, addr string) (string, error) {
+	u, err := parseServerURL(dbType, connString)
+	if err != nil {
+		return "", err
+	}
+	host := u.Hostname()
+	query := u.Query()
+	u.Host = addr
+
+	var params [][2]string
+	switch DatabaseType(dbType) {
+	case Postgres:
+		if query.Get("sslmode") == string(TLSVerifyFull) {
+			return "", fmt.Errorf("sslmode=verify-full checks the server certificate against the SSH tunnel "+
+				"address instead of %s: use --tls-mode verify-ca through a tunnel", host)
+		}
+	case MySQL:
+		if tls := query.Get("tls"); tls != "" && tls != "false" {
+			params = append(params, [2]string{"tls-server-name", host})
+		}
+	case MongoDB:
+		params = append(params, [2]string{"directConnection", "true"})
+		if mongoVerifiesHostname(query) {
+			params = append(params, [2]string{mongoTLSServerNameParam, host})
+		}
+	}
+	return setQueryParams(u.String(), params), nil
+}
+
+// mongoTLSServerNameParam carries the host name of a tunnelled MongoDB server. The driver ignores
+// unknown parameters; the tools are never given it, see mongoToolArgs.
+const mongoTLSServerNameParam = "tlsServerName"
+
+// mongoVerifiesHostname reports whether the parameters of a MongoDB connection string ask for TLS
+// with the host name checked. MongoDB parameter names are case-insensitive.
+func mongoVerifiesHostname(query url.Values) bool {
+	tls, insecure := false, false
+	for key, values := range query {
+		value := strings.EqualFold(values[len(values)-1], "true")
+		switch strings.ToLower(key) {
+		case "tls", "ssl":
+			tls = value
+		case "tlsinsecure", "tlsallowinvalidhostnames":
+			insecure = insecure || value
+		}
+	}
+	return tls && !insecure
+}
+
+// parseServerURL parses a connection string naming a single server over TCP
+func parseServerURL(dbType string, connString string) (*url.URL, error) {
+	if strings.HasPrefix(connString, "mongodb+srv://") {
+		return nil, fmt.Errorf("mongodb+srv:// connection strings resolve several servers, list a single host instead")
+	}
+
+	u, err := url.Parse(connString)
+	if err != nil || strings.Contains(u.Host, ",") {
+		return nil, fmt.Errorf("expected a connection string naming a single server")
+	}
+
+	query := u.Query()
+	switch {
+	case DatabaseType(dbType) == MySQL && query.Has("socket"):
+		return nil, fmt.Errorf("MySQL socket connections have no server address")
+	case DatabaseType(dbType) == Postgres && (query.Has("host") || query.Has("hostaddr") || query.Has("port")):
+		return nil, fmt.Errorf("PostgreSQL host and port must be given in the URL authority, not as parameters")
+	}
+
+	return u, nil
+}
+
+func quotePostgresIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
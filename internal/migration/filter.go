@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TableFilter restricts the rows dumped from a table, or the documents of a MongoDB collection
+type TableFilter struct {
+	// Table is the table as table or schema.table, or the collection name
+	Table string
+	// Where is an SQL predicate, or a MongoDB query in extended JSON; empty selects every row
+	Where string
+}
+
+// ParseTableFilter parses a filter as "table:predicate", e.g. "events:created_at > now() - interval '30 days'"
+func ParseTableFilter(s string) (TableFilter, error) {
+	table, where, ok := strings.Cut(s, ":")
+	table, where = strings.TrimSpace(table), strings.TrimSpace(where)
+	if !ok || table == "" || where == "" {
+		return TableFilter{}, fmt.Errorf("invalid filter %q: expected table:predicate", s)
+	}
+	return TableFilter{Table: table, Where: where}, nil
+}
+
+// ParseTableFilters parses the filters of --where, one filter per table at most
+func ParseTableFilters(values []string) ([]TableFilter, error) {
+	var filters []TableFilter
+	seen := make(map[string]bool)
+	for _, value := range values {
+		filter, err := ParseTableFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[filter.Table] {
+			return nil, fmt.Errorf("table %s is filtered more than once", filter.Table)
+		}
+		seen[filter.Table] = true
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// VerificationFilters returns the filters of the target dump compared with a filtered source dump:
+// the filtered tables are dumped the same way, so that both dumps line up, but without predicate
+func VerificationFilters(filters []TableFilter) []TableFilter {
+	unfiltered := make([]TableFilter, len(filters))
+	for i, filter := range filters {
+		unfiltered[i] = TableFilter{Table: filter.Table}
+	}
+	return unfiltered
+}
+
+// filterTables returns the names of the filtered tables
+func filterTables(filters []TableFilter) []string {
+	tables := make([]string, len(filters))
+	for i, filter := range filters {
+		tables[i] = filter.Table
+	}
+	return tables
+}
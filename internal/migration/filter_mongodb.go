@@ -0,0 +1,186 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mongodump archives start with this magic number, and end their prelude and every segment with a
+// terminator in place of a document length
+const (
+	mongoArchiveMagic      = 0x8199e26d
+	mongoArchiveTerminator = 0xffffffff
+)
+
+// dumpFiltered writes a single archive of the database in which the filtered collections only hold
+// the documents matching their query. mongodump accepts --query for one collection at a time, so
+// every filtered collection is dumped to a temporary archive first, then spliced into the archive of
+// the other collections as it streams.
+func (d *MongoDBDumper) dumpFiltered(ctx context.Context, w io.Writer) error {
+	database, err := DatabaseName(d.connString)
+	if err != nil {
+		return err
+	}
+	if database == "" {
+		return fmt.Errorf("the MongoDB connection string must name the database to filter")
+	}
+
+	var archives []*os.File
+	defer func() {
+		for _, f := range archives {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for _, part := range d.filteredParts() {
+		f, err := os.CreateTemp("", "mongodump-*.archive")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary archive: %w", err)
+		}
+		archives = append(archives, f)
+
+		part.options.archive = f.Name()
+		if err := part.Dump(ctx, io.Discard); err != nil {
+			return err
+		}
+	}
+
+	main := &MongoDBDumper{connString: d.connString, options: dumpOptions{
+		progress:       d.options.progress,
+		ignoreTables:   filterTables(d.options.filters),
+		readPreference: d.options.readPreference,
+	}}
+	pr, pw := io.Pipe()
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := main.Dump(ctx, pw)
+		pw.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	readers := make([]io.Reader, len(archives))
+	for i, f := range archives {
+		readers[i] = f
+	}
+	err = spliceMongoArchives(bufio.NewReader(pr), readers, w)
+	// Unblocks mongodump if the splice stopped early
+	pr.CloseWithError(err)
+	if dumpErr := <-dumpErr; dumpErr != nil {
+		return dumpErr
+	}
+	return err
+}
+
+// filteredParts returns the dumps of the filtered collections
+func (d *MongoDBDumper) filteredParts() []*MongoDBDumper {
+	parts := make([]*MongoDBDumper, len(d.options.filters))
+	for i, filter := range d.options.filters {
+		parts[i] = &MongoDBDumper{connString: d.connString, options: dumpOptions{
+			progress:       d.options.progress,
+			collection:     filter.Table,
+			where:          filter.Where,
+			readPreference: d.options.readPreference,
+		}}
+	}
+	return parts
+}
+
+// validateMongoQueries checks that the filter predicates are extended JSON documents
+func validateMongoQueries(filters []TableFilter) error {
+	for _, filter := range filters {
+		if filter.Where == "" {
+			continue
+		}
+		var query bson.D
+		if err := bson.UnmarshalExtJSON([]byte(filter.Where), false, &query); err != nil {
+			return fmt.Errorf("invalid query for collection %s: %w", filter.Table, err)
+		}
+	}
+	return nil
+}
+
+// spliceMongoArchives writes the archive read from main with the collections of the other archives
+// added: their metadata joins the prelude, and their segments follow the segments of main
+func spliceMongoArchives(main *bufio.Reader, others []io.Reader, w io.Writer) error {
+	out := bufio.NewWriterSize(w, 64*1024)
+
+	if err := readMongoArchiveMagic(main); err != nil {
+		return err
+	}
+	out.Write(binary.LittleEndian.AppendUint32(nil, mongoArchiveMagic))
+
+	// The prelude of main: the archive header and the collection metadata, without its terminator
+	if err := copyMongoArchivePrelude(main, out, true); err != nil {
+		return err
+	}
+
+	readers := make([]*bufio.Reader, len(others))
+	for i, r := range others {
+		readers[i] = bufio.NewReader(r)
+		if err := readMongoArchiveMagic(readers[i]); err != nil {
+			return err
+		}
+		if err := copyMongoArchivePrelude(readers[i], out, false); err != nil {
+			return err
+		}
+	}
+	out.Write(binary.LittleEndian.AppendUint32(nil, mongoArchiveTerminator))
+
+	if _, err := io.Copy(out, main); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	for _, r := range readers {
+		if _, err := io.Copy(out, r); err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+	}
+	return out.Flush()
+}
+
+func readMongoArchiveMagic(r *bufio.Reader) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic[:]) != mongoArchiveMagic {
+		return fmt.Errorf("not a mongodump archive")
+	}
+	return nil
+}
+
+// copyMongoArchivePrelude copies the metadata documents of an archive prelude up to its terminator,
+// which is consumed; the leading archive header is copied only when withHeader is set
+func copyMongoArchivePrelude(r *bufio.Reader, w io.Writer, withHeader bool) error {
+	for first := true; ; first = false {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return fmt.Errorf("failed to read archive prelude: %w", err)
+		}
+		length := binary.LittleEndian.Uint32(size[:])
+		if length == mongoArchiveTerminator {
+			return nil
+		}
+		if length < 5 {
+			return fmt.Errorf("failed to read archive prelude: invalid document length %d", length)
+		}
+
+		doc := make([]byte, length)
+		copy(doc, size[:])
+		if _, err := io.ReadFull(r, doc[4:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("failed to read archive prelude: %w", err)
+		}
+		if !first || withHeader {
+			w.Write(doc)
+		}
+	}
+}
@@ -2,71 +2,206 @@ package migration
 
 import (
 	"context"
+	"data-migration/internal/anonymize"
 	"data-migration/internal/config"
+	"data-migration/internal/metrics"
+	"data-migration/internal/throttle"
+	"data-migration/internal/tracing"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Interval of the progress logs of a migration
+const migrateProgressInterval = 30 * time.Second
+
 type Manager struct {
-	config *config.Config
-	logger *config.Logger
+	config  *config.Config
+	logger  *config.Logger
+	confirm OverwriteConfirmation
+	rules   *anonymize.Rules
+	limiter *throttle.Limiter
+
+	mu       sync.Mutex
+	phases   map[string]time.Duration
+	position SourcePosition
+	dumped   atomic.Int64
+	restored atomic.Int64
+}
+
+// Stats are the figures of a migration run by a Manager
+type Stats struct {
+	Phases        map[string]time.Duration
+	BytesDumped   int64
+	BytesRestored int64
+	// SourcePosition is the replication position the dump is consistent with, when recorded
+	SourcePosition SourcePosition
+}
+
+// OverwriteConfirmation asks whether the existing content of the target may be dropped
+type OverwriteConfirmation func(info TargetInfo) bool
+
+// ManagerOption defines function type for manager options
+type ManagerOption func(*Manager)
+
+// WithOverwriteConfirmation asks for confirmation before overwriting a non-empty target
+func WithOverwriteConfirmation(confirm OverwriteConfirmation) ManagerOption {
+	return func(m *Manager) {
+		m.confirm = confirm
+	}
 }
 
-func NewManager(cfg *config.Config, logger *config.Logger) *Manager {
-	return &Manager{
+// WithBandwidthLimiter limits the migration stream with limiter, which may be shared with other
+// managers and adjusted while they run. Without it, --max-bandwidth limits each migration on its own.
+func WithBandwidthLimiter(limiter *throttle.Limiter) ManagerOption {
+	return func(m *Manager) {
+		m.limiter = limiter
+	}
+}
+
+func NewManager(cfg *config.Config, logger *config.Logger, opts ...ManagerOption) *Manager {
+	m := &Manager{
 		config: cfg,
-		logger: logger,
+		logger: logger.With("db_type", cfg.SourceType),
+		phases: make(map[string]time.Duration),
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
+
+	return m
 }
 
 func (m *Manager) Migrate(ctx context.Context) error {
+	// Refuse to touch a non-empty target unless explicitly allowed
+	if !m.config.StdoutMode {
+		endInspecting := m.startPhase(metrics.PhaseInspecting)
+		inspectCtx, span := tracing.Start(ctx, "inspect_target", tracing.DBSystem(m.config.TargetType))
+		err := m.checkTarget(inspectCtx)
+		tracing.End(span, err)
+		endInspecting()
+		if err != nil {
+			var notEmpty *TargetNotEmptyError
+			if errors.As(err, &notEmpty) {
+				metrics.RecordError(metrics.ErrorTargetNotEmpty)
+			}
+			return err
+		}
+	}
+
+	if m.config.MaskRules != "" {
+		rules, err := anonymize.LoadRules(m.config.MaskRules)
+		if err != nil {
+			return fmt.Errorf("failed to load masking rules: %w", err)
+		}
+		m.rules = rules
+		m.logger.Infow("Masking data", "rules", m.config.MaskRules, "count", len(rules.Rules))
+	}
+
 	// Create source dumper
-	dumper, err := CreateDumper(m.config.SourceType, m.config.SourceConn, m.config.StdoutMode)
+	tables := &tableProgress{logger: m.logger}
+	dumperOpts, err := m.dumperOptions(tables)
+	if err != nil {
+		return err
+	}
+	dumper, err := CreateDumper(m.config.SourceType, m.config.SourceConn, m.config.StdoutMode, dumperOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create dumper: %w", err)
 	}
 
+	limiter, err := m.bandwidthLimiter()
+	if err != nil {
+		return err
+	}
+
+	defer m.startPhase(metrics.PhaseMigrating)()
+
 	// Handle stdout mode
 	if m.config.StdoutMode {
-		m.logger.Info("Streaming database dump to stdout...")
-		return dumper.Dump(ctx, os.Stdout)
+		m.logger.Infow("Streaming database dump to stdout", "phase", "dumping")
+		var stdout io.Writer = os.Stdout
+		if limiter != nil {
+			stdout = throttle.NewWriter(ctx, stdout, limiter)
+		}
+		total, err := m.dump(ctx, dumper, tables, stdout)
+		if err != nil {
+			metrics.RecordError(metrics.ErrorDump)
+			return err
+		}
+		m.logger.Infow("Database dump completed", "phase", "dumping", "bytes", total)
+		return nil
 	}
 
 	// Create target restorer
-	restorer, err := CreateRestorer(m.config.TargetType, m.config.TargetConn)
+	restorerOpts, err := m.restorerOptions()
+	if err != nil {
+		return fmt.Errorf("failed to configure restorer: %w", err)
+	}
+	restorer, err := CreateRestorer(m.config.TargetType, m.config.TargetConn, restorerOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create restorer: %w", err)
 	}
 
-	// Create pipe for streaming
-	reader, writer := io.Pipe()
+	// Buffer the stream so that the dump keeps going while the restore is momentarily slow
+	buffer, err := newStreamBuffer(m.config.BufferSize, m.config.BufferSpillDir)
+	if err != nil {
+		return err
+	}
+	// Unblocks the dump if the restore stopped early, and removes the spill file
+	defer buffer.CloseRead(nil)
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.reportProgress(buffer, done)
 
 	// Setup error channels
 	errChan := make(chan error, 2)
 
 	// Start dump process
 	go func() {
-		defer writer.Close()
-		m.logger.Info("Starting database dump...")
-		if err := dumper.Dump(ctx, writer); err != nil {
-			m.logger.Errorf("Dump error: %v", err)
+		m.logger.Infow("Starting database dump", "phase", "dumping")
+		var sink io.Writer = buffer
+		if limiter != nil {
+			// Limit the dump itself, so that the source is read no faster than the limit even while
+			// the buffer has room or spills to disk
+			sink = throttle.NewWriter(ctx, buffer, limiter)
+		}
+		total, err := m.dump(ctx, dumper, tables, sink)
+		buffer.CloseWrite(err)
+		if err != nil {
+			metrics.RecordError(metrics.ErrorDump)
+			m.logger.Errorw("Dump failed", "phase", "dumping", "bytes", total, "error", err)
 			errChan <- fmt.Errorf("dump failed: %w", err)
 		} else {
 			errChan <- nil
-			m.logger.Info("Database dump completed")
+			m.logger.Infow("Database dump completed", "phase", "dumping", "bytes", total)
 		}
 	}()
 
 	// Start restore process
 	go func() {
-		m.logger.Info("Starting database restore...")
-		if err := restorer.Restore(ctx, reader); err != nil {
-			m.logger.Errorf("Restore error: %v", err)
+		m.logger.Infow("Starting database restore", "phase", "restoring")
+		input := &countingReader{r: buffer, count: m.addRestored}
+		restoreCtx, span := tracing.Start(ctx, "restore", tracing.DBSystem(m.config.TargetType))
+		err := restorer.Restore(restoreCtx, input)
+		span.SetAttributes(tracing.Bytes(input.total))
+		tracing.End(span, err)
+		buffer.CloseRead(err)
+		if err != nil {
+			metrics.RecordError(metrics.ErrorRestore)
+			m.logger.Errorw("Restore failed", "phase", "restoring", "bytes", input.total, "error", err)
 			errChan <- fmt.Errorf("restore failed: %w", err)
 		} else {
 			errChan <- nil
-			m.logger.Info("Database restore completed")
+			m.logger.Infow("Database restore completed", "phase", "restoring", "bytes", input.total)
 		}
 	}()
 
@@ -77,5 +212,362 @@ func (m *Manager) Migrate(ctx context.Context) error {
 		}
 	}
 
+	return m.resetSequences(ctx)
+}
+
+// reportProgress logs the bytes moved so far and the fill level of the buffer until done is closed. A
+// full buffer means the restore is the bottleneck, an empty one the dump.
+func (m *Manager) reportProgress(buffer *streamBuffer, done <-chan struct{}) {
+	ticker := time.NewTicker(migrateProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		level := buffer.Level()
+		fill := float64(level.Memory) / float64(level.Size) * 100
+		bottleneck := "none"
+		switch {
+		case level.Spilled > 0 || fill >= 90:
+			bottleneck = "restore"
+		case fill <= 10:
+			bottleneck = "dump"
+		}
+
+		m.logger.Infow("Migration in progress", "phase", "migrating",
+			"bytes_dumped", m.dumped.Load(),
+			"bytes_restored", m.restored.Load(),
+			"buffer_bytes", level.Memory,
+			"buffer_fill_pct", fmt.Sprintf("%.0f", fill),
+			"buffer_spilled_bytes", level.Spilled,
+			"bottleneck", bottleneck,
+		)
+	}
+}
+
+// bandwidthLimiter returns the limiter of the migration stream, or nil when it is not limited
+func (m *Manager) bandwidthLimiter() (*throttle.Limiter, error) {
+	limiter := m.limiter
+	if limiter == nil && m.config.MaxBandwidth != "" {
+		rate, err := throttle.ParseRate(m.config.MaxBandwidth)
+		if err != nil {
+			return nil, err
+		}
+		if rate > 0 {
+			limiter = throttle.NewLimiter(rate)
+		}
+	}
+
+	if limiter != nil {
+		m.logger.Infow("Limiting migration bandwidth", "max_bandwidth", throttle.FormatRate(limiter.Rate()))
+	}
+	return limiter, nil
+}
+
+// resetSequences moves the target sequences and AUTO_INCREMENT counters past the restored rows. Data-only
+// loads leave them behind, and the next inserts would then collide with the copied rows.
+func (m *Manager) resetSequences(ctx context.Context) error {
+	if DatabaseType(m.config.TargetType) == MongoDB {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "reset_sequences", tracing.DBSystem(m.config.TargetType))
+	resets, err := ResetSequences(ctx, m.config.TargetType, m.config.TargetConn)
+	span.SetAttributes(attribute.Int("migrationdb.sequences_reset", len(resets)))
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to reset sequences: %w", err)
+	}
+
+	for _, reset := range resets {
+		m.logger.Infow("Sequence reset", "phase", "restoring", "table", reset.Table, "column", reset.Column,
+			"sequence", reset.Sequence, "from", reset.From, "to", reset.To)
+	}
+	m.logger.Infow("Sequences reconciled", "phase", "restoring", "reset", len(resets))
 	return nil
 }
+
+// Stats returns the phase durations and byte counts of the migration so far
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	phases := make(map[string]time.Duration, len(m.phases))
+	for name, duration := range m.phases {
+		phases[name] = duration
+	}
+
+	return Stats{
+		Phases:         phases,
+		BytesDumped:    m.dumped.Load(),
+		BytesRestored:  m.restored.Load(),
+		SourcePosition: m.position,
+	}
+}
+
+// startPhase starts a metrics phase and returns the function ending it, which also records its duration
+func (m *Manager) startPhase(name string) func() {
+	start := time.Now()
+	end := metrics.StartPhase(name)
+
+	return func() {
+		end()
+		m.mu.Lock()
+		m.phases[name] += time.Since(start)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) addDumped(n int) {
+	metrics.AddDumped(n)
+	m.dumped.Add(int64(n))
+}
+
+func (m *Manager) addRestored(n int) {
+	metrics.AddRestored(n)
+	m.restored.Add(int64(n))
+}
+
+// dump streams the source dump into w within a trace span, masked when rules are loaded, and returns
+// the number of bytes dumped
+func (m *Manager) dump(ctx context.Context, dumper Dumper, tables *tableProgress, w io.Writer) (int64, error) {
+	var masker *anonymize.Writer
+	if m.rules != nil {
+		var err error
+		if masker, err = anonymize.NewWriter(m.config.SourceType, w, m.rules); err != nil {
+			return 0, err
+		}
+		w = masker
+	}
+
+	ctx, span := tracing.Start(ctx, "dump", tracing.DBSystem(m.config.SourceType))
+	tables.trace(ctx)
+
+	output := &countingWriter{w: w, count: m.addDumped}
+	err := dumper.Dump(ctx, output)
+	if masker != nil {
+		// A masking failure makes the dump tool fail on a closed pipe, so report both
+		if maskErr := masker.Close(); maskErr != nil {
+			if err == nil {
+				err = fmt.Errorf("masking failed: %w", maskErr)
+			} else {
+				err = fmt.Errorf("%w (masking failed: %v)", err, maskErr)
+			}
+		}
+	}
+
+	tables.endSpans(err)
+	span.SetAttributes(tracing.Bytes(output.total))
+	tracing.End(span, err)
+
+	if positioned, ok := dumper.(PositionDumper); ok && err == nil {
+		m.recordPosition(positioned.SourcePosition())
+	}
+	return output.total, err
+}
+
+// recordPosition keeps the source position of the dump for Stats and logs it for a later replication
+// setup
+func (m *Manager) recordPosition(position SourcePosition) {
+	if position.IsZero() {
+		return
+	}
+
+	m.mu.Lock()
+	m.position = position
+	m.mu.Unlock()
+	m.logger.Infow("Source position of the dump", "phase", "dumping",
+		"binlog_position", position.String(), "gtid_set", position.GTIDSet)
+}
+
+// dumperOptions derives the dump options implied by the configuration
+func (m *Manager) dumperOptions(tables *tableProgress) ([]DumperOption, error) {
+	opts := []DumperOption{WithTableProgress(tables)}
+	if m.config.Merge {
+		opts = append(opts, WithDataOnly())
+	}
+	if m.config.MaskRules != "" {
+		opts = append(opts, WithMaskableFormat())
+	}
+	if m.config.Subset != "" {
+		subset, err := ParseSubset(m.config.Subset)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithSubset(subset))
+	}
+	filters, err := ParseTableFilters(m.config.Where)
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) > 0 {
+		opts = append(opts, WithWhere(filters))
+	}
+
+	if m.config.SerializableDeferrable {
+		opts = append(opts, WithSerializableDeferrable())
+	}
+	if m.config.Snapshot != "" {
+		opts = append(opts, WithSnapshot(m.config.Snapshot))
+	}
+	if m.config.ReadPreference != "" {
+		opts = append(opts, WithReadPreference(m.config.ReadPreference))
+	}
+	if m.config.Oplog {
+		opts = append(opts, WithOplog())
+	}
+	if m.config.MasterData {
+		opts = append(opts, WithSourcePosition())
+	}
+	return opts, nil
+}
+
+// restorerOptions derives the restore options implied by the configuration
+func (m *Manager) restorerOptions() ([]RestorerOption, error) {
+	var opts []RestorerOption
+
+	sourceDatabase, err := DatabaseName(m.config.SourceConn)
+	if err != nil {
+		return nil, err
+	}
+	targetDatabase, err := DatabaseName(m.config.TargetConn)
+	if err != nil {
+		return nil, err
+	}
+	if sourceDatabase != "" && targetDatabase != "" && sourceDatabase != targetDatabase {
+		m.logger.Infow("Restoring into a differently named database",
+			"source_database", sourceDatabase, "target_database", targetDatabase)
+	}
+
+	if m.config.Merge {
+		opts = append(opts, WithMerge())
+	}
+	if m.config.Oplog {
+		opts = append(opts, WithOplogReplay())
+	}
+
+	// Masked, subset and filtered PostgreSQL dumps are plain SQL, see WithMaskableFormat, WithSubset and WithWhere
+	if (m.config.MaskRules != "" || m.config.Subset != "" || len(m.config.Where) > 0) && DatabaseType(m.config.TargetType) == Postgres {
+		opts = append(opts, WithPlainFormat())
+	}
+
+	if DatabaseType(m.config.TargetType) == MongoDB {
+		namespaces, err := NamespaceMappingFor(m.config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithNamespaces(namespaces))
+	}
+
+	return opts, nil
+}
+
+// checkTarget inspects the target and enforces the --overwrite / --merge opt-in for non-empty targets
+func (m *Manager) checkTarget(ctx context.Context) error {
+	info, err := InspectTarget(ctx, m.config.TargetType, m.config.TargetConn)
+	if err != nil {
+		return err
+	}
+
+	if info.Objects == 0 {
+		return nil
+	}
+
+	switch {
+	case m.config.Merge:
+		m.logger.Warnw("Target is not empty, merging without dropping existing objects",
+			"phase", "inspecting", "objects", info.Objects, "kind", info.Kind)
+	case m.config.Overwrite:
+		if m.confirm != nil && !m.confirm(info) {
+			return ErrOverwriteDeclined
+		}
+		m.logger.Warnw("Target is not empty, existing objects will be dropped",
+			"phase", "inspecting", "objects", info.Objects, "kind", info.Kind)
+	default:
+		return &TargetNotEmptyError{Info: info}
+	}
+
+	return nil
+}
+
+// tableProgress reports the table progress of the dump tools as metrics, log entries and trace spans
+type tableProgress struct {
+	logger *config.Logger
+
+	mu     sync.Mutex
+	parent context.Context
+	spans  map[string]trace.Span
+}
+
+// trace makes the table spans children of the span in ctx
+func (p *tableProgress) trace(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parent = ctx
+	p.spans = make(map[string]trace.Span)
+}
+
+// endSpans ends the spans of the tables the dump tool did not report as done
+func (p *tableProgress) endSpans(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for table, span := range p.spans {
+		tracing.End(span, err)
+		delete(p.spans, table)
+	}
+}
+
+func (p *tableProgress) TableStarted(table string) {
+	metrics.TableStarted(table)
+	p.logger.Debugw("Dumping table", "phase", "dumping", "table", table)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.parent != nil {
+		_, p.spans[table] = tracing.Start(p.parent, "dump_table", attribute.String("db.collection.name", table))
+	}
+}
+
+func (p *tableProgress) TableDone(table string) {
+	metrics.TableDone(table)
+	p.logger.Infow("Table dumped", "phase", "dumping", "table", table)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if span, ok := p.spans[table]; ok {
+		span.End()
+		delete(p.spans, table)
+	}
+}
+
+// countingWriter reports and totals the number of bytes written through it
+type countingWriter struct {
+	w     io.Writer
+	count func(int)
+	total int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count(n)
+	c.total += int64(n)
+	return n, err
+}
+
+// countingReader reports and totals the number of bytes read through it
+type countingReader struct {
+	r     io.Reader
+	count func(int)
+	total int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count(n)
+	c.total += int64(n)
+	return n, err
+}
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaskConnectionString masks sensitive information in connection strings
+func MaskConnectionString(conn string) string {
+	if conn == "" {
+		return ""
+	}
+
+	// Handle MongoDB connection strings
+	if strings.HasPrefix(conn, "mongodb://") || strings.HasPrefix(conn, "mongodb+srv://") {
+		// Replace password in MongoDB connection string
+		parts := strings.Split(conn, "@")
+		if len(parts) != 2 {
+			return conn // Return original if we can't parse it
+		}
+		auth := strings.Split(parts[0], "://")
+		if len(auth) != 2 {
+			return conn
+		}
+		userPass := strings.Split(auth[1], ":")
+		if len(userPass) != 2 {
+			return conn
+		}
+		return fmt.Sprintf("%s://%s:****@%s", auth[0], userPass[0], parts[1])
+	}
+
+	// Handle go-sql-driver DSNs: user:pass@tcp(host:port)/db
+	if IsMySQLDSN(conn) {
+		base, params := mysqlDSNParams(conn)
+		slash := strings.LastIndex(base, "/")
+		at := strings.LastIndex(base[:slash], "@")
+		if at < 0 {
+			return conn
+		}
+		if colon := strings.Index(base[:at], ":"); colon >= 0 {
+			base = base[:colon+1] + "****" + base[at:]
+		}
+		if params != "" {
+			return base + "?" + params
+		}
+		return base
+	}
+
+	// Handle SQL connection strings
+	u, err := url.Parse(conn)
+	if err != nil {
+		return conn // Return original if we can't parse it
+	}
+
+	if u.User != nil {
+		_, hasPassword := u.User.Password()
+		if hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "****")
+			// Convert to string and manually unescape the asterisks
+			maskedStr := u.String()
+			return strings.ReplaceAll(maskedStr, "%2A", "*")
+		}
+	}
+
+	return u.String()
+}
+
+// maskCommand renders a command line with the credentials of any connection string masked
+func maskCommand(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if flag, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(flag, "--") && strings.Contains(value, "://") {
+			arg = flag + "=" + MaskConnectionString(value)
+		} else if strings.Contains(arg, "://") {
+			arg = MaskConnectionString(arg)
+		}
+
+		if strings.ContainsAny(arg, " \t'\"") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
@@ -4,28 +4,144 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os/exec"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
 )
 
+// mongoToolArgs returns the connection arguments of the MongoDB database tools. The password is
+// moved out of the URI into a temporary --config file; call the returned function once the tool exits.
+func mongoToolArgs(connString string) ([]string, func(), error) {
+	if name := mongoTLSServerName(connString); name != "" {
+		// Unlike the driver, see MongoClientOptions, the tools cannot be told the host name to check
+		return nil, nil, fmt.Errorf("the MongoDB tools check the server certificate against the SSH tunnel address "+
+			"instead of %s: use --tls-mode verify-ca through a tunnel", name)
+	}
+
+	connString, password := splitPassword(connString)
+	if password == "" {
+		return []string{"--uri=" + connString}, func() {}, nil
+	}
+
+	content, err := yaml.Marshal(map[string]string{"password": password})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode MongoDB tools config: %w", err)
+	}
+
+	configFile, remove, err := writeCredentialsFile("mongo-config-*.yaml", string(content))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []string{"--uri=" + connString, "--config=" + configFile}, remove, nil
+}
+
+// describeMongoToolArgs renders the connection arguments of mongoToolArgs without creating any file
+func describeMongoToolArgs(connString string) []string {
+	connString, password := splitPassword(connString)
+	if password == "" {
+		return []string{"--uri=" + connString}
+	}
+	return []string{"--uri=" + connString, "--config=" + credentialsFilePlaceholder}
+}
+
+// MongoClientOptions returns the driver options of connString, checking the server certificate
+// against the host name recorded by ReplaceServerAddress for connections through an SSH tunnel
+func MongoClientOptions(connString string) *options.ClientOptions {
+	opts := options.Client().ApplyURI(connString)
+	if name := mongoTLSServerName(connString); name != "" && opts.TLSConfig != nil {
+		opts.TLSConfig.ServerName = name
+	}
+	return opts
+}
+
+// mongoTLSServerName returns the tlsServerName parameter of a MongoDB connection string
+func mongoTLSServerName(connString string) string {
+	_, rawQuery, _ := strings.Cut(connString, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	return query.Get(mongoTLSServerNameParam)
+}
+
 type MongoDBDumper struct {
 	connString string
+	options    dumpOptions
 }
 
-func NewMongoDBDumper(connString string) *MongoDBDumper {
-	return &MongoDBDumper{connString: connString}
+func NewMongoDBDumper(connString string, opts ...DumperOption) *MongoDBDumper {
+	return &MongoDBDumper{
+		connString: connString,
+		options:    newDumpOptions(opts),
+	}
 }
 
 func (d *MongoDBDumper) GetType() DatabaseType {
 	return MongoDB
 }
 
+// Describe returns the mongodump command line, with credentials masked
+func (d *MongoDBDumper) Describe() string {
+	if len(d.options.filters) > 0 {
+		var commands []string
+		for _, part := range d.filteredParts() {
+			part.options.archive = "<temporary file>"
+			commands = append(commands, maskCommand("mongodump", part.args(describeMongoToolArgs(d.connString))))
+		}
+		main := &MongoDBDumper{options: dumpOptions{
+			ignoreTables:   filterTables(d.options.filters),
+			readPreference: d.options.readPreference,
+		}}
+		return strings.Join(append(commands, maskCommand("mongodump", main.args(describeMongoToolArgs(d.connString)))), "; ")
+	}
+	return maskCommand("mongodump", d.args(describeMongoToolArgs(d.connString)))
+}
+
+func (d *MongoDBDumper) args(connArgs []string) []string {
+	args := connArgs
+	if d.options.archive != "" {
+		args = append(args, "--archive="+d.options.archive)
+	} else {
+		args = append(args, "--archive")
+	}
+
+	if d.options.collection != "" {
+		args = append(args, "--collection="+d.options.collection)
+	}
+	if d.options.where != "" {
+		args = append(args, "--query="+d.options.where)
+	}
+	for _, collection := range d.options.ignoreTables {
+		args = append(args, "--excludeCollection="+collection)
+	}
+
+	if d.options.readPreference != "" {
+		args = append(args, "--readPreference="+d.options.readPreference)
+	}
+	if d.options.oplog {
+		args = append(args, "--oplog")
+	}
+	return args
+}
+
 func (d *MongoDBDumper) Dump(ctx context.Context, w io.Writer) error {
-	cmd := exec.CommandContext(ctx, "mongodump",
-		"--uri="+d.connString,
-		"--archive",
-	)
+	if len(d.options.filters) > 0 {
+		return d.dumpFiltered(ctx, w)
+	}
+
+	connArgs, cleanup, err := mongoToolArgs(d.connString)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "mongodump", d.args(connArgs)...)
 	cmd.Stdout = w
-	cmd.Stderr = io.Discard
+	cmd.Stderr = newTableTracker(MongoDB, d.options.progress)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("mongodump failed: %w", err)
@@ -34,23 +150,126 @@ func (d *MongoDBDumper) Dump(ctx context.Context, w io.Writer) error {
 	return nil
 }
 
+// Namespaces lists the collections covered by the connection string as <database>.<collection>
+func (d *MongoDBDumper) Namespaces(ctx context.Context) ([]string, error) {
+	database, err := DatabaseName(d.connString)
+	if err != nil {
+		return nil, err
+	}
+
+	databases := []string{database}
+	if database == "" {
+		if databases, err = ListDatabases(ctx, string(MongoDB), d.connString); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := mongo.Connect(ctx, MongoClientOptions(d.connString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	var namespaces []string
+	for _, db := range databases {
+		collections, err := client.Database(db).ListCollectionNames(ctx, bson.D{{Key: "type", Value: "collection"}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections of %s: %w", db, err)
+		}
+		for _, collection := range collections {
+			if strings.HasPrefix(collection, "system.") {
+				continue
+			}
+			namespaces = append(namespaces, db+"."+collection)
+		}
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// DumpNamespace writes the raw BSON documents of a single collection to w
+func (d *MongoDBDumper) DumpNamespace(ctx context.Context, ns string, w io.Writer) error {
+	database, collection, ok := strings.Cut(ns, ".")
+	if !ok {
+		return fmt.Errorf("invalid namespace %q: expected <database>.<collection>", ns)
+	}
+
+	// mongodump refuses a --db that differs from the one in the URI
+	connString, err := ReplaceDatabase(d.connString, database)
+	if err != nil {
+		return err
+	}
+
+	connArgs, cleanup, err := mongoToolArgs(connString)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := append(connArgs, "--collection="+collection, "--out=-")
+	if d.options.readPreference != "" {
+		args = append(args, "--readPreference="+d.options.readPreference)
+	}
+	for _, filter := range d.options.filters {
+		if filter.Table == collection && filter.Where != "" {
+			args = append(args, "--query="+filter.Where)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "mongodump", args...)
+	cmd.Stdout = w
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mongodump of %s failed: %w", ns, err)
+	}
+
+	return nil
+}
+
 type MongoDBRestorer struct {
 	connString string
+	options    restoreOptions
 }
 
-func NewMongoDBRestorer(connString string) *MongoDBRestorer {
-	return &MongoDBRestorer{connString: connString}
+func NewMongoDBRestorer(connString string, opts ...RestorerOption) *MongoDBRestorer {
+	return &MongoDBRestorer{
+		connString: connString,
+		options:    newRestoreOptions(opts),
+	}
 }
 
 func (r *MongoDBRestorer) GetType() DatabaseType {
 	return MongoDB
 }
 
+// Describe returns the mongorestore command line, with credentials masked
+func (r *MongoDBRestorer) Describe() string {
+	return maskCommand("mongorestore", r.args(describeMongoToolArgs(r.connString)))
+}
+
+func (r *MongoDBRestorer) args(connArgs []string) []string {
+	args := append(connArgs, "--archive")
+
+	if !r.options.merge {
+		// Match the other engines: replace existing collections rather than appending to them
+		args = append(args, "--drop")
+	}
+	if r.options.oplog {
+		args = append(args, "--oplogReplay")
+	}
+	return append(args, r.options.namespaces.restoreArgs()...)
+}
+
 func (r *MongoDBRestorer) Restore(ctx context.Context, reader io.Reader) error {
-	cmd := exec.CommandContext(ctx, "mongorestore",
-		"--uri="+r.connString,
-		"--archive",
-	)
+	connArgs, cleanup, err := mongoToolArgs(r.connString)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "mongorestore", r.args(connArgs)...)
 	cmd.Stdin = reader
 	cmd.Stderr = io.Discard
 
@@ -4,41 +4,157 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
-	"os"
 	"os/exec"
 	"strings"
 )
 
 type MySQLDumper struct {
 	connString string
+	options    dumpOptions
+	position   SourcePosition
 }
 
-func NewMySQLDumper(connString string) *MySQLDumper {
-	return &MySQLDumper{connString: connString}
+func NewMySQLDumper(connString string, opts ...DumperOption) *MySQLDumper {
+	return &MySQLDumper{
+		connString: connString,
+		options:    newDumpOptions(opts),
+	}
 }
 
 func (d *MySQLDumper) GetType() DatabaseType {
 	return MySQL
 }
 
-func (d *MySQLDumper) Dump(ctx context.Context, w io.Writer) error {
-	cmd := exec.CommandContext(ctx, "mysqldump",
-		"--defaults-extra-file="+createMySQLConfigFile(d.connString),
+// Describe returns the mysqldump command line; credentials live in a temporary options file
+func (d *MySQLDumper) Describe() string {
+	if d.options.subset != nil {
+		schema := &MySQLDumper{connString: d.connString, options: dumpOptions{noData: true}}
+		return fmt.Sprintf("%s; rows of %s and the rows they reference", schema.Describe(), d.options.subset)
+	}
+	if len(d.options.filters) > 0 {
+		parts := d.filteredParts()
+		commands := make([]string, len(parts))
+		for i, part := range parts {
+			commands[i] = part.Describe()
+		}
+		return strings.Join(commands, "; ")
+	}
+	return maskCommand("mysqldump", d.args(credentialsFilePlaceholder, mysqlDatabase(d.connString)))
+}
+
+func (d *MySQLDumper) args(configFile, database string) []string {
+	args := []string{
+		"--defaults-extra-file=" + configFile,
 		"--single-transaction",
 		"--quick",
 		"--compress",
-	)
-	cmd.Stdout = w
-	cmd.Stderr = io.Discard
+		"--verbose", // Table progress, written to stderr
+	}
+
+	if d.options.dataOnly {
+		// Skip the DROP TABLE / CREATE TABLE statements so existing tables are kept
+		args = append(args, "--no-create-info")
+	}
+
+	if d.options.noData {
+		args = append(args, "--no-data")
+	}
+
+	if d.options.maskable {
+		// Name the columns of every INSERT so that masking rules can find them
+		args = append(args, "--complete-insert")
+	}
+
+	if d.options.sourcePosition {
+		// Writes the binlog position as a comment, read back by Dump
+		args = append(args, mysqlSourceDataOption()+"=2")
+	}
+
+	for _, table := range d.options.ignoreTables {
+		args = append(args, "--ignore-table="+database+"."+table)
+	}
+	if d.options.where != "" {
+		args = append(args, "--where="+d.options.where)
+	}
+
+	args = append(args, database)
+	return append(args, d.options.tables...)
+}
+
+func (d *MySQLDumper) Dump(ctx context.Context, w io.Writer) error {
+	if d.options.subset != nil {
+		return d.dumpSubset(ctx, w)
+	}
+	if len(d.options.filters) > 0 {
+		return d.dumpFiltered(ctx, w)
+	}
+
+	database := mysqlDatabase(d.connString)
+	if database == "" {
+		return fmt.Errorf("the MySQL connection string must name the database to dump")
+	}
+
+	configFile, cleanup, err := createMySQLConfigFile(ctx, d.connString)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "mysqldump", d.args(configFile, database)...)
+	progress := newTableTracker(MySQL, d.options.progress)
+	header := &headerWriter{w: w, limit: mysqlDumpHeaderSize}
+	cmd.Stdout = header
+	cmd.Stderr = progress
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("mysqldump failed: %w", err)
 	}
+	finishTables(progress)
 
+	if d.options.sourcePosition {
+		d.position = parseMySQLDumpPosition(header.head)
+	}
+
+	return nil
+}
+
+// dumpFiltered runs mysqldump once for the tables without filter, then once per filtered table with
+// its --where predicate. Each run reads its own snapshot.
+func (d *MySQLDumper) dumpFiltered(ctx context.Context, w io.Writer) error {
+	for i, part := range d.filteredParts() {
+		if err := part.Dump(ctx, w); err != nil {
+			return err
+		}
+		if i == 0 {
+			d.position = part.position
+		}
+	}
 	return nil
 }
 
+// SourcePosition returns the binlog position and GTID set of the last dump made WithSourcePosition
+func (d *MySQLDumper) SourcePosition() SourcePosition {
+	return d.position
+}
+
+// filteredParts returns the dumpers of a filtered dump
+func (d *MySQLDumper) filteredParts() []*MySQLDumper {
+	rest := d.options
+	rest.filters = nil
+	rest.ignoreTables = filterTables(d.options.filters)
+	parts := []*MySQLDumper{{connString: d.connString, options: rest}}
+
+	for _, filter := range d.options.filters {
+		table := d.options
+		table.filters = nil
+		table.tables = []string{filter.Table}
+		table.where = filter.Where
+		table.sourcePosition = false
+		parts = append(parts, &MySQLDumper{connString: d.connString, options: table})
+	}
+	return parts
+}
+
 type MySQLRestorer struct {
 	connString string
 }
@@ -51,74 +167,35 @@ func (r *MySQLRestorer) GetType() DatabaseType {
 	return MySQL
 }
 
-func (r *MySQLRestorer) Restore(ctx context.Context, reader io.Reader) error {
-	cmd := exec.CommandContext(ctx, "mysql",
-		"--defaults-extra-file="+createMySQLConfigFile(r.connString),
-	)
-	cmd.Stdin = reader
-	cmd.Stderr = io.Discard
+// Describe returns the mysql command line; credentials live in a temporary options file
+func (r *MySQLRestorer) Describe() string {
+	return maskCommand("mysql", r.args(credentialsFilePlaceholder))
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mysql restore failed: %w", err)
-	}
+func (r *MySQLRestorer) args(configFile string) []string {
+	args := []string{"--defaults-extra-file=" + configFile}
 
-	return nil
+	// The dump has no USE statement, so the target database must be selected
+	if database := mysqlDatabase(r.connString); database != "" {
+		args = append(args, database)
+	}
+	return args
 }
 
-// Helper function to create MySQL config file from connection string
-func createMySQLConfigFile(connString string) string {
-	// Parse MySQL connection string
-	// Expected format: user:pass@tcp(host:port)/dbname
-
-	// Create a temporary file
-	tempFile, err := os.CreateTemp("", "mysql-config-*.cnf")
+func (r *MySQLRestorer) Restore(ctx context.Context, reader io.Reader) error {
+	configFile, cleanup, err := createMySQLConfigFile(ctx, r.connString)
 	if err != nil {
-		log.Printf("Failed to create temp file: %v", err)
-		return ""
-	}
-
-	// Extract credentials and connection info from connection string
-	user := ""
-	password := ""
-	host := ""
-	port := "3306" // default MySQL port
-
-	// Basic parsing of MySQL connection string
-	if parts := strings.Split(connString, "@"); len(parts) == 2 {
-		// Extract credentials
-		credentials := strings.Split(parts[0], ":")
-		if len(credentials) == 2 {
-			user = credentials[0]
-			password = credentials[1]
-		}
-
-		// Extract host and port
-		hostPart := parts[1]
-		if strings.HasPrefix(hostPart, "tcp(") {
-			hostPart = strings.TrimPrefix(hostPart, "tcp(")
-			hostPart = strings.Split(hostPart, ")/")[0]
-			hostDetails := strings.Split(hostPart, ":")
-			if len(hostDetails) == 2 {
-				host = hostDetails[0]
-				port = hostDetails[1]
-			} else {
-				host = hostPart
-			}
-		}
+		return err
 	}
+	defer cleanup()
 
-	// Write MySQL configuration
-	configContent := fmt.Sprintf(`[client]
-user=%s
-password=%s
-host=%s
-port=%s
-`, user, password, host, port)
+	cmd := exec.CommandContext(ctx, "mysql", r.args(configFile)...)
+	cmd.Stdin = reader
+	cmd.Stderr = io.Discard
 
-	if err := os.WriteFile(tempFile.Name(), []byte(configContent), 0600); err != nil {
-		log.Printf("Failed to write config file: %v", err)
-		return ""
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mysql restore failed: %w", err)
 	}
 
-	return tempFile.Name()
+	return nil
 }
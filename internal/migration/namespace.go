@@ -0,0 +1,242 @@
+package migration
+
+import (
+	"data-migration/internal/config"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// NamespaceRule renames the MongoDB namespaces matching From into To.
+// Patterns follow mongorestore's syntax: '*' matches any characters and
+// '$name$' captures a part that can be reused in To.
+type NamespaceRule struct {
+	From string
+	To   string
+}
+
+// NamespaceMapping describes which MongoDB namespaces are restored and under which name
+type NamespaceMapping struct {
+	Include []string
+	Exclude []string
+	Rules   []NamespaceRule
+}
+
+// NewNamespaceMapping builds a mapping from the raw include, exclude and paired from/to patterns
+func NewNamespaceMapping(include, exclude, from, to []string) (NamespaceMapping, error) {
+	if len(from) != len(to) {
+		return NamespaceMapping{}, fmt.Errorf("--ns-from and --ns-to must be given the same number of times (got %d and %d)", len(from), len(to))
+	}
+
+	m := NamespaceMapping{
+		Include: include,
+		Exclude: exclude,
+	}
+	for i := range from {
+		m.Rules = append(m.Rules, NamespaceRule{From: from[i], To: to[i]})
+	}
+
+	if err := m.validate(); err != nil {
+		return NamespaceMapping{}, err
+	}
+
+	return m, nil
+}
+
+// NamespaceMappingFor returns the namespace mapping configured for a MongoDB migration,
+// including the remap needed when the target connection string names another database
+func NamespaceMappingFor(cfg *config.Config) (NamespaceMapping, error) {
+	m, err := NewNamespaceMapping(cfg.NsInclude, cfg.NsExclude, cfg.NsFrom, cfg.NsTo)
+	if err != nil {
+		return NamespaceMapping{}, err
+	}
+
+	if DatabaseType(cfg.SourceType) != MongoDB || cfg.StdoutMode {
+		return m, nil
+	}
+
+	sourceDatabase, err := DatabaseName(cfg.SourceConn)
+	if err != nil {
+		return NamespaceMapping{}, err
+	}
+	targetDatabase, err := DatabaseName(cfg.TargetConn)
+	if err != nil {
+		return NamespaceMapping{}, err
+	}
+	if sourceDatabase != "" && targetDatabase != "" && sourceDatabase != targetDatabase {
+		// The archive keeps the source namespaces, so renaming the database needs an explicit remap
+		m.Rules = append(m.Rules, NamespaceRule{From: sourceDatabase + ".*", To: targetDatabase + ".*"})
+	}
+
+	return m, nil
+}
+
+// IsZero reports whether the mapping restores every namespace under its original name
+func (m NamespaceMapping) IsZero() bool {
+	return len(m.Include) == 0 && len(m.Exclude) == 0 && len(m.Rules) == 0
+}
+
+// Map returns the target namespace for a source namespace, and false when it is filtered out
+func (m NamespaceMapping) Map(ns string) (string, bool) {
+	if len(m.Include) > 0 && !matchesAny(m.Include, ns) {
+		return "", false
+	}
+	if matchesAny(m.Exclude, ns) {
+		return "", false
+	}
+
+	for _, rule := range m.Rules {
+		if target, ok := rule.apply(ns); ok {
+			return target, true
+		}
+	}
+
+	return ns, true
+}
+
+// restoreArgs returns the mongorestore flags implementing the mapping
+func (m NamespaceMapping) restoreArgs() []string {
+	var args []string
+	for _, pattern := range m.Include {
+		args = append(args, "--nsInclude="+pattern)
+	}
+	for _, pattern := range m.Exclude {
+		args = append(args, "--nsExclude="+pattern)
+	}
+	for _, rule := range m.Rules {
+		args = append(args, "--nsFrom="+rule.From, "--nsTo="+rule.To)
+	}
+	return args
+}
+
+func (m NamespaceMapping) validate() error {
+	for _, pattern := range append(append([]string{}, m.Include...), m.Exclude...) {
+		if !strings.Contains(pattern, ".") && pattern != "*" {
+			return fmt.Errorf("invalid namespace pattern %q: expected <database>.<collection>", pattern)
+		}
+	}
+
+	for _, rule := range m.Rules {
+		re, names, err := compileNamespacePattern(rule.From)
+		if err != nil {
+			return err
+		}
+
+		wildcards := re.NumSubexp() - len(names)
+		if strings.Count(rule.To, "*") > wildcards {
+			return fmt.Errorf("--ns-to %q uses more wildcards than --ns-from %q", rule.To, rule.From)
+		}
+		for _, name := range variableNames(rule.To) {
+			if !slices.Contains(names, name) {
+				return fmt.Errorf("--ns-to %q uses $%s$ which is not captured by --ns-from %q", rule.To, name, rule.From)
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply renames ns when it matches the rule's From pattern
+func (r NamespaceRule) apply(ns string) (string, bool) {
+	re, _, err := compileNamespacePattern(r.From)
+	if err != nil {
+		return "", false
+	}
+
+	match := re.FindStringSubmatch(ns)
+	if match == nil {
+		return "", false
+	}
+
+	var wildcards []string
+	variables := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			wildcards = append(wildcards, match[i])
+		} else {
+			variables[name] = match[i]
+		}
+	}
+
+	var target strings.Builder
+	for _, token := range tokenizeNamespacePattern(r.To) {
+		switch {
+		case token == "*":
+			if len(wildcards) > 0 {
+				target.WriteString(wildcards[0])
+				wildcards = wildcards[1:]
+			}
+		case isVariable(token):
+			target.WriteString(variables[strings.Trim(token, "$")])
+		default:
+			target.WriteString(token)
+		}
+	}
+
+	return target.String(), true
+}
+
+// compileNamespacePattern turns a mongorestore namespace pattern into an anchored regular expression
+func compileNamespacePattern(pattern string) (*regexp.Regexp, []string, error) {
+	var expr strings.Builder
+	var names []string
+
+	expr.WriteString("^")
+	for _, token := range tokenizeNamespacePattern(pattern) {
+		switch {
+		case token == "*":
+			expr.WriteString("(.*)")
+		case isVariable(token):
+			name := strings.Trim(token, "$")
+			if slices.Contains(names, name) {
+				return nil, nil, fmt.Errorf("invalid namespace pattern %q: $%s$ is used twice", pattern, name)
+			}
+			names = append(names, name)
+			expr.WriteString("(?P<" + name + ">.*?)")
+		default:
+			expr.WriteString(regexp.QuoteMeta(token))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+	}
+
+	return re, names, nil
+}
+
+var namespaceTokenPattern = regexp.MustCompile(`\*|\$[A-Za-z0-9_]+\$|[^*$]+|\$`)
+
+func tokenizeNamespacePattern(pattern string) []string {
+	return namespaceTokenPattern.FindAllString(pattern, -1)
+}
+
+func isVariable(token string) bool {
+	return len(token) > 2 && strings.HasPrefix(token, "$") && strings.HasSuffix(token, "$")
+}
+
+func variableNames(pattern string) []string {
+	var names []string
+	for _, token := range tokenizeNamespacePattern(pattern) {
+		if isVariable(token) {
+			names = append(names, strings.Trim(token, "$"))
+		}
+	}
+	return names
+}
+
+func matchesAny(patterns []string, ns string) bool {
+	for _, pattern := range patterns {
+		re, _, err := compileNamespacePattern(pattern)
+		if err == nil && re.MatchString(ns) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package migration
+
+import (
+	"data-migration/internal/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceMappingMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		from    []string
+		to      []string
+		ns      string
+		want    string
+		wantOK  bool
+	}{
+		{name: "no mapping", ns: "shop.orders", want: "shop.orders", wantOK: true},
+		{name: "included", include: []string{"shop.*"}, ns: "shop.orders", want: "shop.orders", wantOK: true},
+		{name: "not included", include: []string{"shop.*"}, ns: "billing.invoices", wantOK: false},
+		{name: "excluded", exclude: []string{"shop.tmp_*"}, ns: "shop.tmp_orders", wantOK: false},
+		{name: "exclude wins over include", include: []string{"*"}, exclude: []string{"shop.orders"}, ns: "shop.orders", wantOK: false},
+		{name: "literal dot", include: []string{"shop.orders"}, ns: "shopXorders", wantOK: false},
+		{
+			name: "wildcard", from: []string{"shop.*"}, to: []string{"store.*"},
+			ns: "shop.orders", want: "store.orders", wantOK: true,
+		},
+		{
+			name: "no match passes through", from: []string{"shop.*"}, to: []string{"store.*"},
+			ns: "billing.invoices", want: "billing.invoices", wantOK: true,
+		},
+		{
+			name: "variables", from: []string{"$db$.$coll$_v1"}, to: []string{"$db$_v2.$coll$"},
+			ns: "shop.orders_v1", want: "shop_v2.orders", wantOK: true,
+		},
+		{
+			name: "variables reordered", from: []string{"$db$.$coll$"}, to: []string{"$coll$.$db$"},
+			ns: "shop.orders", want: "orders.shop", wantOK: true,
+		},
+		{
+			name: "wildcards in order", from: []string{"*.archive_*"}, to: []string{"*_archive.*"},
+			ns: "shop.archive_2023", want: "shop_archive.2023", wantOK: true,
+		},
+		{
+			name: "first matching rule wins", from: []string{"shop.orders", "shop.*"}, to: []string{"a.b", "c.*"},
+			ns: "shop.orders", want: "a.b", wantOK: true,
+		},
+		{
+			name: "regexp characters are literal", from: []string{"shop.a+b"}, to: []string{"shop.ab"},
+			ns: "shop.aab", want: "shop.aab", wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewNamespaceMapping(tt.include, tt.exclude, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("NewNamespaceMapping() error = %v", err)
+			}
+			got, ok := m.Map(tt.ns)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Map(%q) = %q, %v, want %q, %v", tt.ns, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewNamespaceMappingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		from    []string
+		to      []string
+		wantErr string
+	}{
+		{name: "unpaired rules", from: []string{"a.*", "b.*"}, to: []string{"c.*"}, wantErr: "same number of times"},
+		{name: "pattern without collection", include: []string{"shop"}, wantErr: "expected <database>.<collection>"},
+		{name: "unmapped variable", from: []string{"$db$.*"}, to: []string{"$other$.*"}, wantErr: "$other$ which is not captured"},
+		{name: "too many wildcards", from: []string{"shop.*"}, to: []string{"*.*"}, wantErr: "more wildcards"},
+		{name: "variables are not wildcards", from: []string{"$db$.orders"}, to: []string{"*.orders"}, wantErr: "more wildcards"},
+		{name: "variable used twice", from: []string{"$x$.$x$"}, to: []string{"$x$.y"}, wantErr: "is used twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNamespaceMapping(tt.include, nil, tt.from, tt.to)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewNamespaceMapping() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamespaceMappingFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		ns       string
+		want     string
+		wantArgs []string
+	}{
+		{
+			name: "same database",
+			cfg:  config.Config{SourceType: "mongodb", SourceConn: "mongodb://src/shop", TargetConn: "mongodb://dst/shop"},
+			ns:   "shop.orders", want: "shop.orders",
+		},
+		{
+			name:     "renamed database",
+			cfg:      config.Config{SourceType: "mongodb", SourceConn: "mongodb://src/shop", TargetConn: "mongodb://dst/store"},
+			ns:       "shop.orders",
+			want:     "store.orders",
+			wantArgs: []string{"--nsFrom=shop.*", "--nsTo=store.*"},
+		},
+		{
+			name: "explicit rules first",
+			cfg: config.Config{
+				SourceType: "mongodb", SourceConn: "mongodb://src/shop", TargetConn: "mongodb://dst/store",
+				NsFrom: []string{"shop.orders"}, NsTo: []string{"archive.orders"},
+			},
+			ns:       "shop.orders",
+			want:     "archive.orders",
+			wantArgs: []string{"--nsFrom=shop.orders", "--nsTo=archive.orders", "--nsFrom=shop.*", "--nsTo=store.*"},
+		},
+		{
+			name: "no target database",
+			cfg:  config.Config{SourceType: "mongodb", SourceConn: "mongodb://src/shop", TargetConn: "mongodb://dst"},
+			ns:   "shop.orders", want: "shop.orders",
+		},
+		{
+			name: "stdout",
+			cfg:  config.Config{SourceType: "mongodb", SourceConn: "mongodb://src/shop", StdoutMode: true},
+			ns:   "shop.orders", want: "shop.orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NamespaceMappingFor(&tt.cfg)
+			if err != nil {
+				t.Fatalf("NamespaceMappingFor() error = %v", err)
+			}
+			if got, ok := m.Map(tt.ns); !ok || got != tt.want {
+				t.Errorf("Map(%q) = %q, %v, want %q", tt.ns, got, ok, tt.want)
+			}
+			if args := m.restoreArgs(); !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("restoreArgs() = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Plan describes what a migration would do, without moving any data
+type Plan struct {
+	DumpCommand    string
+	RestoreCommand string
+	Objects        []PlannedObject
+	Verification   string
+	Destructive    []string
+}
+
+// PlannedObject is a table or collection selected for migration, with its estimated size
+type PlannedObject struct {
+	Name   string
+	Target string
+	Rows   int64
+	Bytes  int64
+}
+
+// TotalBytes returns the estimated size of all planned objects
+func (p *Plan) TotalBytes() int64 {
+	var total int64
+	for _, object := range p.Objects {
+		total += object.Bytes
+	}
+	return total
+}
+
+// Plan introspects the source and target and returns the migration plan.
+// createTarget indicates that the target database does not exist yet and would be created.
+func (m *Manager) Plan(ctx context.Context, createTarget bool) (*Plan, error) {
+	plan := &Plan{}
+
+	dumperOpts, err := m.dumperOptions(&tableProgress{logger: m.logger})
+	if err != nil {
+		return nil, err
+	}
+	dumper, err := CreateDumper(m.config.SourceType, m.config.SourceConn, m.config.StdoutMode, dumperOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dumper: %w", err)
+	}
+	plan.DumpCommand = describe(dumper)
+
+	objects, err := ListObjects(ctx, m.config.SourceType, m.config.SourceConn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect source database: %w", err)
+	}
+
+	if m.config.StdoutMode {
+		plan.Objects = objects
+		plan.Verification = "none: the dump is streamed to stdout"
+		return plan, nil
+	}
+
+	restorerOpts, err := m.restorerOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure restorer: %w", err)
+	}
+	restorer, err := CreateRestorer(m.config.TargetType, m.config.TargetConn, restorerOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create restorer: %w", err)
+	}
+	plan.RestoreCommand = describe(restorer)
+
+	namespaces := NamespaceMapping{}
+	if DatabaseType(m.config.SourceType) == MongoDB {
+		if namespaces, err = NamespaceMappingFor(m.config); err != nil {
+			return nil, err
+		}
+	}
+	for _, object := range objects {
+		target, ok := namespaces.Map(object.Name)
+		if !ok {
+			continue
+		}
+		object.Target = target
+		plan.Objects = append(plan.Objects, object)
+	}
+
+	plan.Verification = m.verificationStrategy(namespaces)
+
+	if createTarget {
+		plan.Destructive = append(plan.Destructive, "none: the target database does not exist and would be created")
+		return plan, nil
+	}
+
+	info, err := InspectTarget(ctx, m.config.TargetType, m.config.TargetConn)
+	if err != nil {
+		return nil, err
+	}
+	plan.Destructive = m.destructiveActions(info)
+
+	return plan, nil
+}
+
+func (m *Manager) verificationStrategy(namespaces NamespaceMapping) string {
+	switch {
+	case m.config.SkipVerification:
+		return "skipped (--skip-verify)"
+	case m.config.Merge:
+		return "skipped: the target keeps its pre-existing data in merge mode"
+	case m.config.MaskRules != "":
+		return "skipped: the target holds masked data (--mask-rules)"
+	case m.config.Subset != "":
+		return "skipped: the target holds a subset of the source (--subset)"
+	case len(m.config.Where) > 0 && namespaces.IsZero():
+		return fmt.Sprintf("streaming comparison of the filtered source and target dumps in %d byte chunks, then SHA-256 checksum of the target",
+			m.config.VerifyChunkSize)
+	case !namespaces.IsZero():
+		return fmt.Sprintf("per-collection comparison of source and mapped target dumps in %d byte chunks, then SHA-256 checksum of the target",
+			m.config.VerifyChunkSize)
+	default:
+		return fmt.Sprintf("streaming comparison of source and target dumps in %d byte chunks, then SHA-256 checksum of the target",
+			m.config.VerifyChunkSize)
+	}
+}
+
+func (m *Manager) destructiveActions(info TargetInfo) []string {
+	if info.Objects == 0 {
+		return []string{"none: the target database is empty"}
+	}
+
+	switch {
+	case m.config.Merge:
+		return []string{fmt.Sprintf("none: rows are appended to the %d existing %s", info.Objects, info.Kind)}
+	case m.config.Overwrite:
+		var action string
+		switch DatabaseType(m.config.TargetType) {
+		case Postgres:
+			action = "pg_restore --clean --if-exists drops every restored object before recreating it"
+			if m.config.MaskRules != "" || m.config.Subset != "" || len(m.config.Where) > 0 {
+				action = "the dump runs DROP ... IF EXISTS before recreating every object"
+			}
+		case MySQL:
+			action = "the dump runs DROP TABLE IF EXISTS before recreating every table"
+		case MongoDB:
+			action = "mongorestore --drop drops every restored collection before recreating it"
+		}
+		return []string{
+			fmt.Sprintf("the target already contains %d %s", info.Objects, info.Kind),
+			action,
+		}
+	default:
+		return []string{fmt.Sprintf("none: the migration would abort because the target contains %d %s (use --overwrite or --merge)",
+			info.Objects, info.Kind)}
+	}
+}
+
+func describe(v interface{}) string {
+	if d, ok := v.(Describer); ok {
+		return d.Describe()
+	}
+	return "unknown"
+}
+
+// ListObjects returns the tables or collections of a database with their estimated row counts and sizes
+func ListObjects(ctx context.Context, dbType string, connString string) ([]PlannedObject, error) {
+	switch DatabaseType(dbType) {
+	case Postgres:
+		return querySQLObjects(ctx, "postgres", connString, `SELECT schemaname || '.' || relname, n_live_tup, pg_total_relation_size(relid)
+			FROM pg_stat_user_tables ORDER BY 1`)
+	case MySQL:
+		dsn, err := MySQLDSN(connString)
+		if err != nil {
+			return nil, err
+		}
+		return querySQLObjects(ctx, "mysql", dsn, `SELECT table_name, COALESCE(table_rows, 0), COALESCE(data_length + index_length, 0)
+			FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY 1`)
+	case MongoDB:
+		return listMongoObjects(ctx, connString)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+func querySQLObjects(ctx context.Context, driver, dsn, query string) ([]PlannedObject, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var objects []PlannedObject
+	for rows.Next() {
+		var object PlannedObject
+		if err := rows.Scan(&object.Name, &object.Rows, &object.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to read table statistics: %w", err)
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+func listMongoObjects(ctx context.Context, connString string) ([]PlannedObject, error) {
+	namespaces, err := NewMongoDBDumper(connString).Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, MongoClientOptions(connString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	objects := make([]PlannedObject, 0, len(namespaces))
+	for _, ns := range namespaces {
+		database, collection, _ := strings.Cut(ns, ".")
+
+		var stats struct {
+			Count int64 `bson:"count"`
+			Size  int64 `bson:"size"`
+		}
+		err := client.Database(database).RunCommand(ctx, bson.D{{Key: "collStats", Value: collection}}).Decode(&stats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read statistics of %s: %w", ns, err)
+		}
+
+		objects = append(objects, PlannedObject{Name: ns, Rows: stats.Count, Bytes: stats.Size})
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mysqldump writes the binlog position and GTID set before any table
+const mysqlDumpHeaderSize = 1024 * 1024
+
+var (
+	mysqlChangeSourceRE = regexp.MustCompile(`CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+	mysqlGTIDPurgedRE   = regexp.MustCompile(`GTID_PURGED=(?:/\*!\d+ '\+'\*/ )?'([^']*)'`)
+)
+
+var (
+	sourceDataOnce   sync.Once
+	sourceDataOption string
+)
+
+// mysqlSourceDataOption returns the mysqldump option recording the binlog position: --source-data
+// since MySQL 8.0.26, --master-data before and on MariaDB
+func mysqlSourceDataOption() string {
+	sourceDataOnce.Do(func() {
+		sourceDataOption = "--master-data"
+		if help, err := exec.Command("mysqldump", "--help").Output(); err == nil && strings.Contains(string(help), "--source-data") {
+			sourceDataOption = "--source-data"
+		}
+	})
+	return sourceDataOption
+}
+
+// parseMySQLDumpPosition reads the position written by --source-data=2 and the GTID set of
+// SET @@GLOBAL.GTID_PURGED from the start of a dump
+func parseMySQLDumpPosition(head []byte) SourcePosition {
+	var position SourcePosition
+	if m := mysqlChangeSourceRE.FindSubmatch(head); m != nil {
+		position.BinlogFile = string(m[1])
+		position.BinlogPos, _ = strconv.ParseInt(string(m[2]), 10, 64)
+	}
+	if m := mysqlGTIDPurgedRE.FindSubmatch(head); m != nil {
+		// Long sets are split over several lines
+		position.GTIDSet = strings.Join(strings.Fields(string(m[1])), "")
+	}
+	return position
+}
+
+// headerWriter keeps the first limit bytes written through it
+type headerWriter struct {
+	w     io.Writer
+	limit int
+	head  []byte
+}
+
+func (h *headerWriter) Write(p []byte) (int, error) {
+	if room := h.limit - len(h.head); room > 0 {
+		h.head = append(h.head, p[:min(room, len(p))]...)
+	}
+	return h.w.Write(p)
+}
@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 )
 
 type PostgresDumper struct {
 	connString      string
 	useCustomFormat bool
+	options         dumpOptions
 }
 
-func NewPostgresDumper(connString string, useCustomFormat bool) *PostgresDumper {
+func NewPostgresDumper(connString string, useCustomFormat bool, opts ...DumperOption) *PostgresDumper {
 	return &PostgresDumper{
 		connString:      connString,
 		useCustomFormat: useCustomFormat,
+		options:         newDumpOptions(opts),
 	}
 }
 
@@ -24,66 +27,179 @@ func (d *PostgresDumper) GetType() DatabaseType {
 	return Postgres
 }
 
-func (d *PostgresDumper) Dump(ctx context.Context, w io.Writer) error {
-	var stderr bytes.Buffer
+// Describe returns the pg_dump command line, with credentials masked
+func (d *PostgresDumper) Describe() string {
+	if d.options.subset != nil {
+		return fmt.Sprintf("%s; rows of %s and the rows they reference; %s",
+			maskCommand("pg_dump", d.schemaDumper("pre-data", "").args()), d.options.subset,
+			maskCommand("pg_dump", d.schemaDumper("post-data", "").args()))
+	}
+	if len(d.options.filters) > 0 {
+		filtered := make([]*subsetTable, len(d.options.filters))
+		rows := make([]string, len(d.options.filters))
+		for i, filter := range d.options.filters {
+			filtered[i] = &subsetTable{quoted: filter.Table}
+			rows[i] = "rows of " + filter.Table
+			if filter.Where != "" {
+				rows[i] += " where " + filter.Where
+			}
+		}
+
+		// The filtered rows follow the data of the other tables
+		var commands []string
+		for _, part := range d.filteredParts("", filtered) {
+			commands = append(commands, maskCommand("pg_dump", part.args()))
+			if part.options.section == "data" || part.options.dataOnly {
+				commands = append(commands, rows...)
+			}
+		}
+		return strings.Join(commands, "; ")
+	}
+	return maskCommand("pg_dump", d.args())
+}
 
+func (d *PostgresDumper) args() []string {
 	args := []string{
 		"--verbose",
 		"--no-owner",      // Add this to avoid permission issues
 		"--no-privileges", // Add this to avoid permission issues
 	}
 
-	if d.useCustomFormat {
+	if d.options.dataOnly {
+		args = append(args, "--data-only")
+	}
+
+	if d.options.section != "" {
+		args = append(args, "--section="+d.options.section)
+	}
+	if d.options.snapshot != "" {
+		args = append(args, "--snapshot="+d.options.snapshot)
+	}
+	if d.options.serializableDeferrable {
+		args = append(args, "--serializable-deferrable")
+	}
+	for _, table := range d.options.excludeData {
+		args = append(args, "--exclude-table-data="+table)
+	}
+
+	switch {
+	case d.options.maskable:
+		// Masking rewrites the COPY blocks of a plain dump, which psql restores, so the dump has to
+		// drop the existing objects itself
+		args = append(args, "--format=plain")
+		if !d.options.dataOnly {
+			args = append(args, "--clean", "--if-exists")
+		}
+	case d.useCustomFormat:
 		args = append(args, "--format=custom")
-	} else {
+	default:
 		args = append(args, "--format=plain")
 	}
 
-	args = append(args, d.connString)
+	// The password travels through PGPASSWORD, see Dump
+	connString, _ := splitPassword(d.connString)
+	return append(args, connString)
+}
+
+func (d *PostgresDumper) Dump(ctx context.Context, w io.Writer) error {
+	if d.options.subset != nil {
+		return d.dumpSubset(ctx, w)
+	}
+	if len(d.options.filters) > 0 {
+		return d.dumpFiltered(ctx, w)
+	}
+
+	var stderr bytes.Buffer
 
-	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+	_, password := splitPassword(d.connString)
+	cmd := exec.CommandContext(ctx, "pg_dump", d.args()...)
+	cmd.Env = commandEnv("PGPASSWORD", password)
 
+	progress := newTableTracker(Postgres, d.options.progress)
 	cmd.Stdout = w
-	cmd.Stderr = &stderr
+	cmd.Stderr = io.MultiWriter(&stderr, progress)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("pg_dump failed: %v, stderr: %s", err, stderr.String())
 	}
+	finishTables(progress)
 
 	return nil
 }
 
 type PostgresRestorer struct {
 	connString string
+	options    restoreOptions
 }
 
-func NewPostgresRestorer(connString string) *PostgresRestorer {
-	return &PostgresRestorer{connString: connString}
+func NewPostgresRestorer(connString string, opts ...RestorerOption) *PostgresRestorer {
+	return &PostgresRestorer{
+		connString: connString,
+		options:    newRestoreOptions(opts),
+	}
 }
 
 func (r *PostgresRestorer) GetType() DatabaseType {
 	return Postgres
 }
 
-func (r *PostgresRestorer) Restore(ctx context.Context, reader io.Reader) error {
-	var stderr bytes.Buffer
+// Describe returns the pg_restore command line, or psql for plain dumps, with credentials masked
+func (r *PostgresRestorer) Describe() string {
+	return maskCommand(r.command(), r.args())
+}
 
-	cmd := exec.CommandContext(ctx, "pg_restore",
+func (r *PostgresRestorer) command() string {
+	if r.options.plain {
+		return "psql"
+	}
+	return "pg_restore"
+}
+
+func (r *PostgresRestorer) args() []string {
+	connString, _ := splitPassword(r.connString)
+	if r.options.plain {
+		// The dump carries its own DROP statements, see PostgresDumper.args
+		return []string{
+			"--no-psqlrc",
+			"--quiet",
+			"--set=ON_ERROR_STOP=1",
+			fmt.Sprintf("--dbname=%s", connString),
+		}
+	}
+
+	args := []string{
 		"--verbose",
 		"--no-owner",      // Add this to avoid permission issues
 		"--no-privileges", // Add this to avoid permission issues
-		"--clean",
-		"--if-exists",
+	}
+
+	if r.options.merge {
+		// Append rows into the existing schema without dropping anything
+		args = append(args, "--data-only")
+	} else {
+		args = append(args, "--clean", "--if-exists")
+	}
+
+	return append(args,
 		"--no-comments",        // Optional: skip restoring comments
 		"--no-security-labels", // Optional: skip security labels
-		fmt.Sprintf("--dbname=%s", r.connString),
+		// The password travels through PGPASSWORD, see Restore
+		fmt.Sprintf("--dbname=%s", connString),
 	)
+}
+
+func (r *PostgresRestorer) Restore(ctx context.Context, reader io.Reader) error {
+	var stderr bytes.Buffer
+
+	_, password := splitPassword(r.connString)
+	cmd := exec.CommandContext(ctx, r.command(), r.args()...)
+	cmd.Env = commandEnv("PGPASSWORD", password)
 
 	cmd.Stdin = reader
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("pg_restore failed: %v, stderr: %s", err, stderr.String())
+		return fmt.Errorf("%s failed: %v, stderr: %s", r.command(), err, stderr.String())
 	}
 
 	return nil
@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// TableProgress receives the tables and collections a dump tool starts and finishes
+type TableProgress interface {
+	TableStarted(table string)
+	TableDone(table string)
+}
+
+// progressPatterns match the verbose output lines of a dump tool announcing a table. Tools
+// without a done pattern dump tables one at a time, so a new table completes the previous one.
+type progressPatterns struct {
+	start *regexp.Regexp
+	done  *regexp.Regexp
+}
+
+var tableProgressPatterns = map[DatabaseType]progressPatterns{
+	Postgres: {
+		start: regexp.MustCompile(`dumping contents of table "([^"]+)"`),
+	},
+	MySQL: {
+		start: regexp.MustCompile("^-- Retrieving table structure for table (\\S+)\\.\\.\\."),
+	},
+	MongoDB: {
+		start: regexp.MustCompile(`\twriting (\S+) to `),
+		done:  regexp.MustCompile(`\tdone dumping (\S+) \(`),
+	},
+}
+
+// tableTracker is the stderr of a dump tool, turning its verbose output into TableProgress calls
+type tableTracker struct {
+	progress TableProgress
+	patterns progressPatterns
+	current  string
+	partial  []byte
+}
+
+// newTableTracker returns the writer for the dump tool output, or io.Discard without progress
+func newTableTracker(dbType DatabaseType, progress TableProgress) io.Writer {
+	if progress == nil {
+		return io.Discard
+	}
+	return &tableTracker{progress: progress, patterns: tableProgressPatterns[dbType]}
+}
+
+func (t *tableTracker) Write(p []byte) (int, error) {
+	t.partial = append(t.partial, p...)
+	for {
+		end := bytes.IndexByte(t.partial, '\n')
+		if end < 0 {
+			break
+		}
+		t.line(string(t.partial[:end]))
+		t.partial = t.partial[end+1:]
+	}
+	return len(p), nil
+}
+
+func (t *tableTracker) line(line string) {
+	if t.patterns.done != nil {
+		if match := t.patterns.done.FindStringSubmatch(line); match != nil {
+			t.progress.TableDone(match[1])
+			return
+		}
+	}
+
+	if match := t.patterns.start.FindStringSubmatch(line); match != nil {
+		if t.patterns.done == nil && t.current != "" {
+			t.progress.TableDone(t.current)
+		}
+		t.current = match[1]
+		t.progress.TableStarted(match[1])
+	}
+}
+
+// finishTables completes the table still in progress once the dump tool succeeded
+func finishTables(w io.Writer) {
+	if t, ok := w.(*tableTracker); ok && t.patterns.done == nil && t.current != "" {
+		t.progress.TableDone(t.current)
+		t.current = ""
+	}
+}
@@ -0,0 +1,179 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReadOnly is a source database made read-only by SetReadOnly
+type ReadOnly struct {
+	description string
+	undo        func(ctx context.Context) error
+}
+
+// String describes how the writes are blocked
+func (r *ReadOnly) String() string {
+	return r.description
+}
+
+// Undo makes the database writable again
+func (r *ReadOnly) Undo(ctx context.Context) error {
+	return r.undo(ctx)
+}
+
+// SetReadOnly blocks the writes to the database behind connString so that its last changes can be
+// applied to the target: default_transaction_read_only on PostgreSQL, whose other sessions are
+// terminated, super_read_only (read_only on MariaDB) on MySQL and fsyncLock on MongoDB
+func SetReadOnly(ctx context.Context, dbType string, connString string) (*ReadOnly, error) {
+	switch DatabaseType(dbType) {
+	case Postgres:
+		return setPostgresReadOnly(ctx, connString)
+	case MySQL:
+		return setMySQLReadOnly(ctx, connString)
+	case MongoDB:
+		return setMongoDBReadOnly(ctx, connString)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+func setPostgresReadOnly(ctx context.Context, connString string) (*ReadOnly, error) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	var database string
+	if err := db.QueryRowContext(ctx, "SELECT current_database()").Scan(&database); err != nil {
+		return nil, fmt.Errorf("failed to read database name: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, "ALTER DATABASE "+quotePostgresIdentifier(database)+" SET default_transaction_read_only = on"); err != nil {
+		return nil, fmt.Errorf("failed to make %s read-only: %w", database, err)
+	}
+
+	readOnly := &ReadOnly{
+		description: fmt.Sprintf("default_transaction_read_only=on on database %s", database),
+		undo: func(ctx context.Context) error {
+			return resetPostgresReadOnly(ctx, connString, database)
+		},
+	}
+
+	// The setting only applies to new sessions, so the open ones reconnect read-only
+	var terminated int
+	err = db.QueryRowContext(ctx, `SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid() AND backend_type = 'client backend'
+		AND application_name <> $1`, postgresApplicationName).Scan(&terminated)
+	if err != nil {
+		readOnly.Undo(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("failed to terminate the sessions of %s: %w", database, err)
+	}
+	readOnly.description += fmt.Sprintf(", %d sessions terminated", terminated)
+
+	return readOnly, nil
+}
+
+func resetPostgresReadOnly(ctx context.Context, connString, database string) error {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	// New sessions start read-only, including this one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET default_transaction_read_only = off"); err != nil {
+		return fmt.Errorf("failed to make %s writable: %w", database, err)
+	}
+	if _, err := conn.ExecContext(ctx, "ALTER DATABASE "+quotePostgresIdentifier(database)+" RESET default_transaction_read_only"); err != nil {
+		return fmt.Errorf("failed to make %s writable: %w", database, err)
+	}
+	return nil
+}
+
+func setMySQLReadOnly(ctx context.Context, connString string) (*ReadOnly, error) {
+	dsn, err := MySQLDSN(connString)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	var readOnly bool
+	if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.read_only").Scan(&readOnly); err != nil {
+		return nil, fmt.Errorf("failed to read read_only: %w", err)
+	}
+
+	// MariaDB has no super_read_only, its read_only also blocks the users with SUPER
+	variable := "super_read_only"
+	var previous bool
+	if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.super_read_only").Scan(&previous); err != nil {
+		variable, previous = "read_only", readOnly
+	}
+
+	if _, err := db.ExecContext(ctx, "SET GLOBAL "+variable+" = ON"); err != nil {
+		return nil, fmt.Errorf("failed to set %s: %w", variable, err)
+	}
+
+	return &ReadOnly{
+		description: variable + "=ON",
+		undo: func(ctx context.Context) error {
+			db, err := sql.Open("mysql", dsn)
+			if err != nil {
+				return fmt.Errorf("failed to create database connection: %w", err)
+			}
+			defer db.Close()
+
+			// Turning super_read_only off keeps read_only on, which is restored on its own
+			statement := fmt.Sprintf("SET GLOBAL %s = %t", variable, previous)
+			if variable == "super_read_only" {
+				statement += fmt.Sprintf(", GLOBAL read_only = %t", readOnly)
+			}
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", variable, err)
+			}
+			return nil
+		},
+	}, nil
+}
+
+func setMongoDBReadOnly(ctx context.Context, connString string) (*ReadOnly, error) {
+	client, err := mongo.Connect(ctx, MongoClientOptions(connString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "fsync", Value: 1}, {Key: "lock", Value: true}}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock writes: %w", err)
+	}
+
+	return &ReadOnly{
+		description: "fsyncLock",
+		undo: func(ctx context.Context) error {
+			client, err := mongo.Connect(ctx, MongoClientOptions(connString))
+			if err != nil {
+				return fmt.Errorf("failed to create MongoDB client: %w", err)
+			}
+			defer client.Disconnect(ctx)
+
+			if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "fsyncUnlock", Value: 1}}).Err(); err != nil {
+				return fmt.Errorf("failed to unlock writes: %w", err)
+			}
+			return nil
+		},
+	}, nil
+}
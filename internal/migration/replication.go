@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"fmt"
+	"time"
+)
+
+// Follower captures the changes written to the source database and applies them to the target.
+// Changes are applied at least once: the ones made between Prepare and the snapshot of the initial
+// load are replayed, so inserts are applied as upserts and updates and deletes are idempotent.
+type Follower interface {
+	// Prepare starts capturing changes. It runs before the initial load so that no write is lost.
+	Prepare(ctx context.Context) error
+	// Follow applies the captured changes to the target until ctx is done, calling report after
+	// every batch of changes and whenever the target has caught up
+	Follow(ctx context.Context, report func(FollowStatus)) error
+	// Cleanup removes what Prepare keeps on the source to capture changes; following cannot resume afterwards
+	Cleanup(ctx context.Context) error
+	// Close releases the connections of the follower
+	Close() error
+}
+
+// FollowStatus describes the progress of a Follower
+type FollowStatus struct {
+	// Position is the source position of the last applied change
+	Position string
+	// Applied counts the changes applied since Follow started
+	Applied int64
+	// Lag is the age of the last applied change, zero once caught up
+	Lag time.Duration
+	// LagBytes is the amount of source log left to apply, -1 when unknown
+	LagBytes int64
+	// CaughtUp reports that every captured change was applied
+	CaughtUp bool
+}
+
+// FollowerOption configures optional behaviour of a Follower
+type FollowerOption func(*followOptions)
+
+type followOptions struct {
+	slot       string
+	namespaces NamespaceMapping
+	interval   time.Duration
+	resume     bool
+	position   string
+}
+
+// DefaultReplicationSlot names the PostgreSQL replication slot and publication used by default
+const DefaultReplicationSlot = "migrationdb"
+
+// WithReplicationSlot names the PostgreSQL logical replication slot and publication
+func WithReplicationSlot(name string) FollowerOption {
+	return func(o *followOptions) {
+		o.slot = name
+	}
+}
+
+// WithFollowNamespaces restricts and renames the followed MongoDB namespaces like the restore does
+func WithFollowNamespaces(m NamespaceMapping) FollowerOption {
+	return func(o *followOptions) {
+		o.namespaces = m
+	}
+}
+
+// WithResume resumes following from an earlier run instead of capturing changes from now on.
+// position is the last position reported by that run; PostgreSQL resumes from its replication slot instead.
+func WithResume(position string) FollowerOption {
+	return func(o *followOptions) {
+		o.resume = true
+		o.position = position
+	}
+}
+
+func newFollowOptions(opts []FollowerOption) followOptions {
+	o := followOptions{slot: DefaultReplicationSlot, interval: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// CreateFollower returns the Follower of the given database type
+func CreateFollower(dbType string, sourceConn, targetConn string, logger *config.Logger, opts ...FollowerOption) (Follower, error) {
+	switch DatabaseType(dbType) {
+	case Postgres:
+		return newPostgresFollower(sourceConn, targetConn, logger, newFollowOptions(opts))
+	case MySQL:
+		return newMySQLFollower(sourceConn, targetConn, logger, newFollowOptions(opts))
+	case MongoDB:
+		return newMongoDBFollower(sourceConn, targetConn, logger, newFollowOptions(opts))
+	default:
+		return nil, fmt.Errorf("following changes is not supported for %s", dbType)
+	}
+}
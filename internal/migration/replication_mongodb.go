@@ -0,0 +1,230 @@
+package migration
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDBFollower opens a change stream on the source, from the cluster time reached before the
+// initial load, and replays the document changes on the target
+type mongoDBFollower struct {
+	sourceConn string
+	targetConn string
+	database   string
+	logger     *config.Logger
+	opts       followOptions
+
+	source    *mongo.Client
+	target    *mongo.Client
+	startTime primitive.Timestamp
+}
+
+// mongoChange is the part of a change event the follower uses
+type mongoChange struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Ns            struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey  bson.Raw `bson:"documentKey"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+func newMongoDBFollower(sourceConn, targetConn string, logger *config.Logger, opts followOptions) (*mongoDBFollower, error) {
+	database, err := DatabaseName(sourceConn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoDBFollower{
+		sourceConn: sourceConn,
+		targetConn: targetConn,
+		database:   database,
+		logger:     logger,
+		opts:       opts,
+	}, nil
+}
+
+func (f *mongoDBFollower) Prepare(ctx context.Context) error {
+	var err error
+	if f.source, err = mongo.Connect(ctx, MongoClientOptions(f.sourceConn)); err != nil {
+		return fmt.Errorf("failed to connect to source: %w", err)
+	}
+	if f.target, err = mongo.Connect(ctx, MongoClientOptions(f.targetConn)); err != nil {
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+
+	var hello struct {
+		SetName       string              `bson:"setName"`
+		Msg           string              `bson:"msg"`
+		OperationTime primitive.Timestamp `bson:"operationTime"`
+	}
+	if err := f.source.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to read source topology: %w", err)
+	}
+	// Change streams need the oplog of a replica set, or a sharded cluster behind mongos
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return fmt.Errorf("following changes requires a replica set or sharded cluster source")
+	}
+	if f.opts.resume {
+		if f.startTime, err = parseMongoTimestamp(f.opts.position); err != nil {
+			return err
+		}
+		f.logger.Infow("Resuming change stream", "cluster_time", mongoTimestamp(f.startTime))
+		return nil
+	}
+	if hello.OperationTime.IsZero() {
+		return fmt.Errorf("source did not report its operation time")
+	}
+
+	f.startTime = hello.OperationTime
+	f.logger.Infow("Capturing change stream", "cluster_time", mongoTimestamp(f.startTime))
+	return nil
+}
+
+func (f *mongoDBFollower) Follow(ctx context.Context, report func(FollowStatus)) error {
+	if f.source == nil {
+		return fmt.Errorf("follower is not prepared")
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{
+		"insert", "update", "replace", "delete", "drop", "rename", "dropDatabase", "invalidate",
+	}}}}}}}}
+	streamOpts := options.ChangeStream().
+		SetStartAtOperationTime(&f.startTime).
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(f.opts.interval)
+
+	var stream *mongo.ChangeStream
+	var err error
+	if f.database != "" {
+		stream, err = f.source.Database(f.database).Watch(ctx, pipeline, streamOpts)
+	} else {
+		stream, err = f.source.Watch(ctx, pipeline, streamOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open change stream: %w", err)
+	}
+	defer stream.Close(context.Background())
+
+	status := FollowStatus{Position: mongoTimestamp(f.startTime), LagBytes: -1}
+	for {
+		if !stream.TryNext(ctx) {
+			if err := stream.Err(); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("failed to read change stream: %w", err)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// No change arrived within the await time
+			status.Lag = 0
+			status.CaughtUp = true
+			report(status)
+			continue
+		}
+
+		var change mongoChange
+		if err := stream.Decode(&change); err != nil {
+			return fmt.Errorf("failed to decode change event: %w", err)
+		}
+		applied, err := f.apply(ctx, change)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s on %s.%s: %w", change.OperationType, change.Ns.DB, change.Ns.Coll, err)
+		}
+
+		// A later Follow call resumes here, replaying the changes of the same cluster time
+		f.startTime = change.ClusterTime
+		status.Applied += applied
+		status.Position = mongoTimestamp(change.ClusterTime)
+		status.Lag = time.Since(time.Unix(int64(change.ClusterTime.T), 0))
+		status.CaughtUp = false
+		report(status)
+	}
+}
+
+// Cleanup does nothing: change streams keep nothing on the source
+func (f *mongoDBFollower) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+func (f *mongoDBFollower) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if f.target != nil {
+		f.target.Disconnect(ctx)
+	}
+	if f.source != nil {
+		return f.source.Disconnect(ctx)
+	}
+	return nil
+}
+
+// apply replays a change on the mapped target collection and returns the number of changes applied
+func (f *mongoDBFollower) apply(ctx context.Context, change mongoChange) (int64, error) {
+	switch change.OperationType {
+	case "invalidate":
+		return 0, fmt.Errorf("change stream invalidated, the followed database or collection was dropped or renamed")
+	case "drop", "rename", "dropDatabase":
+		f.logger.Warnw("Collection change on the source is not replicated, apply it to the target",
+			"operation", change.OperationType, "namespace", change.Ns.DB+"."+change.Ns.Coll)
+		return 0, nil
+	}
+
+	target, ok := f.opts.namespaces.Map(change.Ns.DB + "." + change.Ns.Coll)
+	if !ok {
+		return 0, nil
+	}
+	database, collection, ok := strings.Cut(target, ".")
+	if !ok {
+		return 0, fmt.Errorf("invalid target namespace %q", target)
+	}
+	coll := f.target.Database(database).Collection(collection)
+
+	switch change.OperationType {
+	case "insert", "update", "replace":
+		if len(change.FullDocument) == 0 {
+			// The document was deleted since the update, the delete event follows
+			return 0, nil
+		}
+		_, err := coll.ReplaceOne(ctx, change.DocumentKey, change.FullDocument, options.Replace().SetUpsert(true))
+		if err != nil {
+			return 0, err
+		}
+	case "delete":
+		if _, err := coll.DeleteOne(ctx, change.DocumentKey); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+// mongoTimestamp renders a cluster time as seconds.increment
+func mongoTimestamp(ts primitive.Timestamp) string {
+	return fmt.Sprintf("%d.%d", ts.T, ts.I)
+}
+
+func parseMongoTimestamp(s string) (primitive.Timestamp, error) {
+	seconds, increment, ok := strings.Cut(s, ".")
+	t, err := strconv.ParseUint(seconds, 10, 32)
+	if err == nil && ok {
+		var i uint64
+		if i, err = strconv.ParseUint(increment, 10, 32); err == nil {
+			return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+		}
+	}
+	return primitive.Timestamp{}, fmt.Errorf("invalid cluster time %q: expected seconds.increment, e.g. 1714615200.3", s)
+}
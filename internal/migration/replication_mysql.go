@@ -0,0 +1,539 @@
+package migration
+
+import (
+	"context"
+	"crypto/rand"
+	"data-migration/internal/config"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// Interval between the binlog heartbeats sent by the source when it has no event to send
+const mysqlHeartbeatPeriod = time.Second
+
+// mysqlFollower reads the row-based binlog of the source like a replica and applies the row events
+// of the followed database to the target, one source transaction per target transaction
+type mysqlFollower struct {
+	conn     *mysqlConn
+	source   *sql.DB
+	target   *sql.DB
+	database string
+	logger   *config.Logger
+	opts     followOptions
+
+	flavor    string
+	position  gomysql.Position
+	tables    map[string]*mysqlTable
+	lastCheck time.Time
+}
+
+func newMySQLFollower(sourceConn, targetConn string, logger *config.Logger, opts followOptions) (*mysqlFollower, error) {
+	conn, err := parseMySQLConn(sourceConn)
+	if err != nil {
+		return nil, err
+	}
+	if conn.DBName == "" {
+		return nil, fmt.Errorf("following changes requires a database in the source connection string")
+	}
+	if conn.Net == "unix" {
+		return nil, fmt.Errorf("following changes requires a TCP source connection, not a Unix socket")
+	}
+
+	sourceConfig, err := conn.driverConfig()
+	if err != nil {
+		return nil, err
+	}
+	source, err := sql.Open("mysql", sourceConfig.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source connection: %w", err)
+	}
+
+	target, err := openMySQLTarget(targetConn)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+
+	return &mysqlFollower{
+		conn:     conn,
+		source:   source,
+		target:   target,
+		database: conn.DBName,
+		logger:   logger,
+		opts:     opts,
+		tables:   make(map[string]*mysqlTable),
+	}, nil
+}
+
+// openMySQLTarget opens the target with the session settings of mysqldump output: UTC timestamps,
+// which the binlog reader produces, and no foreign key checks, since rows arrive in source commit order
+func openMySQLTarget(targetConn string) (*sql.DB, error) {
+	conn, err := parseMySQLConn(targetConn)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := conn.driverConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+	cfg.Params["foreign_key_checks"] = "0"
+
+	target, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target connection: %w", err)
+	}
+	return target, nil
+}
+
+func (f *mysqlFollower) Prepare(ctx context.Context) error {
+	var format, image, version string
+	err := f.source.QueryRowContext(ctx, "SELECT @@GLOBAL.binlog_format, @@GLOBAL.binlog_row_image, VERSION()").Scan(&format, &image, &version)
+	if err != nil {
+		return fmt.Errorf("failed to read binlog settings: %w", err)
+	}
+	if !strings.EqualFold(format, "ROW") || !strings.EqualFold(image, "FULL") {
+		return fmt.Errorf("following changes requires binlog_format=ROW and binlog_row_image=FULL on the source (currently %s and %s)", format, image)
+	}
+
+	f.flavor = gomysql.MySQLFlavor
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		f.flavor = gomysql.MariaDBFlavor
+	}
+
+	if f.opts.resume {
+		if f.position, err = parseBinlogPosition(f.opts.position); err != nil {
+			return err
+		}
+		f.logger.Infow("Resuming from binlog position", "position", formatBinlogPosition(f.position))
+		return nil
+	}
+
+	if f.position, err = f.binlogPosition(ctx); err != nil {
+		return err
+	}
+	f.logger.Infow("Capturing binlog changes", "position", formatBinlogPosition(f.position))
+	return nil
+}
+
+// formatBinlogPosition renders a binlog position as file:offset, the form read by parseBinlogPosition
+func formatBinlogPosition(pos gomysql.Position) string {
+	return fmt.Sprintf("%s:%d", pos.Name, pos.Pos)
+}
+
+func parseBinlogPosition(s string) (gomysql.Position, error) {
+	name, offset, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return gomysql.Position{}, fmt.Errorf("invalid binlog position %q: expected file:offset, e.g. binlog.000042:1337", s)
+	}
+	pos, err := strconv.ParseUint(offset, 10, 32)
+	if err != nil {
+		return gomysql.Position{}, fmt.Errorf("invalid binlog position %q: %w", s, err)
+	}
+	return gomysql.Position{Name: name, Pos: uint32(pos)}, nil
+}
+
+// binlogPosition returns the current binlog file and position of the source
+func (f *mysqlFollower) binlogPosition(ctx context.Context) (gomysql.Position, error) {
+	// MySQL 8.4 removed SHOW MASTER STATUS in favor of SHOW BINARY LOG STATUS, unknown to older servers
+	rows, err := f.source.QueryContext(ctx, "SHOW BINARY LOG STATUS")
+	if err != nil {
+		rows, err = f.source.QueryContext(ctx, "SHOW MASTER STATUS")
+	}
+	if err != nil {
+		return gomysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return gomysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return gomysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+		}
+		return gomysql.Position{}, fmt.Errorf("binary logging is disabled on the source")
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil || len(values) < 2 {
+		return gomysql.Position{}, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+
+	pos, err := strconv.ParseUint(string(values[1]), 10, 32)
+	if err != nil {
+		return gomysql.Position{}, fmt.Errorf("invalid binlog position %q: %w", values[1], err)
+	}
+	return gomysql.Position{Name: string(values[0]), Pos: uint32(pos)}, nil
+}
+
+func (f *mysqlFollower) Follow(ctx context.Context, report func(FollowStatus)) error {
+	syncer, err := f.syncer()
+	if err != nil {
+		return err
+	}
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(f.position)
+	if err != nil {
+		return fmt.Errorf("failed to start reading the binlog at %s: %w", formatBinlogPosition(f.position), err)
+	}
+
+	status := FollowStatus{LagBytes: -1}
+	var tx *sql.Tx
+	var pending int64
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	begin := func() error {
+		if tx != nil {
+			return nil
+		}
+		tx, err = f.target.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start target transaction: %w", err)
+		}
+		pending = 0
+		return nil
+	}
+	commit := func(header *replication.EventHeader) error {
+		if tx != nil {
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to commit target transaction: %w", err)
+			}
+			tx = nil
+			status.Applied += pending
+		}
+		f.position.Pos = header.LogPos
+		status.Position = formatBinlogPosition(f.position)
+		status.Lag = time.Since(time.Unix(int64(header.Timestamp), 0))
+		status.CaughtUp = false
+		status.LagBytes = f.lagBytes(ctx, status.LagBytes)
+		report(status)
+		return nil
+	}
+
+	for {
+		event, err := streamer.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read binlog: %w", err)
+		}
+
+		switch e := event.Event.(type) {
+		case *replication.RotateEvent:
+			f.position = gomysql.Position{Name: string(e.NextLogName), Pos: uint32(e.Position)}
+		case *replication.QueryEvent:
+			query := strings.TrimSpace(string(e.Query))
+			switch {
+			case strings.EqualFold(query, "BEGIN"):
+				if err := begin(); err != nil {
+					return err
+				}
+			case strings.EqualFold(query, "COMMIT"):
+				if err := commit(event.Header); err != nil {
+					return err
+				}
+			default:
+				if string(e.Schema) == f.database || strings.Contains(query, f.database) {
+					// The table definitions may have changed
+					f.tables = make(map[string]*mysqlTable)
+					f.logger.Warnw("Schema change on the source is not replicated, apply it to the target", "query", query)
+				}
+				if err := commit(event.Header); err != nil {
+					return err
+				}
+			}
+		case *replication.RowsEvent:
+			if string(e.Table.Schema) != f.database {
+				continue
+			}
+			if err := begin(); err != nil {
+				return err
+			}
+			n, err := f.applyRows(ctx, tx, event.Header.EventType, e)
+			if err != nil {
+				return fmt.Errorf("failed to apply binlog event at %s:%d: %w", f.position.Name, event.Header.LogPos, err)
+			}
+			pending += n
+		case *replication.XIDEvent:
+			if err := commit(event.Header); err != nil {
+				return err
+			}
+		case *replication.GenericEvent:
+			if event.Header.EventType == replication.HEARTBEAT_EVENT || event.Header.EventType == replication.HEARTBEAT_LOG_EVENT_V2 {
+				// The source sends heartbeats only when it has nothing left to send
+				if tx == nil {
+					status.Lag = 0
+					status.CaughtUp = true
+					status.LagBytes = f.lagBytes(ctx, status.LagBytes)
+					report(status)
+				}
+			}
+		}
+	}
+}
+
+// Cleanup does nothing: the binlog client keeps nothing on the source
+func (f *mysqlFollower) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+func (f *mysqlFollower) Close() error {
+	f.target.Close()
+	return f.source.Close()
+}
+
+// syncer creates the binlog client, registered on the source as a replica with a random server ID
+func (f *mysqlFollower) syncer() (*replication.BinlogSyncer, error) {
+	host, port, err := net.SplitHostPort(f.conn.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL address %q: %w", f.conn.Addr, err)
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL port %q: %w", port, err)
+	}
+
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	// Stay clear of the small server IDs usually given to real servers
+	serverID := binary.BigEndian.Uint32(id[:]) | 1<<31
+
+	handler, _ := log.NewNullHandler()
+	cfg := replication.BinlogSyncerConfig{
+		ServerID:                serverID,
+		Flavor:                  f.flavor,
+		Host:                    host,
+		Port:                    uint16(portNumber),
+		User:                    f.conn.User,
+		Password:                f.conn.Passwd,
+		HeartbeatPeriod:         mysqlHeartbeatPeriod,
+		TimestampStringLocation: time.UTC,
+		Logger:                  log.NewDefault(handler),
+	}
+	if f.conn.tlsMode != "" && f.conn.tlsMode != "false" {
+		if cfg.TLSConfig, err = f.conn.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	return replication.NewBinlogSyncer(cfg), nil
+}
+
+// lagBytes returns how far the applied position is behind the end of the source binlog, checked at
+// most every few seconds. previous is returned in between, and -1 when the files differ.
+func (f *mysqlFollower) lagBytes(ctx context.Context, previous int64) int64 {
+	if time.Since(f.lastCheck) < 5*time.Second {
+		return previous
+	}
+	f.lastCheck = time.Now()
+
+	current, err := f.binlogPosition(ctx)
+	if err != nil || current.Name != f.position.Name {
+		return -1
+	}
+	return int64(current.Pos) - int64(f.position.Pos)
+}
+
+// applyRows applies a rows event to the target table of the same name and returns the number of rows changed
+func (f *mysqlFollower) applyRows(ctx context.Context, tx *sql.Tx, eventType replication.EventType, e *replication.RowsEvent) (int64, error) {
+	table, err := f.table(ctx, string(e.Table.Table), int(e.ColumnCount))
+	if err != nil {
+		return 0, err
+	}
+
+	switch eventType {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+		for _, row := range e.Rows {
+			statement, args := table.upsert(row)
+			if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+				return 0, err
+			}
+		}
+		return int64(len(e.Rows)), nil
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		// Rows come as before and after image pairs
+		for i := 0; i+1 < len(e.Rows); i += 2 {
+			statement, args := table.update(e.Rows[i], e.Rows[i+1])
+			if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+				return 0, err
+			}
+		}
+		return int64(len(e.Rows) / 2), nil
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+		for _, row := range e.Rows {
+			statement, args := table.delete(row)
+			if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+				return 0, err
+			}
+		}
+		return int64(len(e.Rows)), nil
+	default:
+		return 0, nil
+	}
+}
+
+// table returns the column definitions of a followed table, read from the source since the binlog
+// only carries column positions
+func (f *mysqlFollower) table(ctx context.Context, name string, columnCount int) (*mysqlTable, error) {
+	if table, ok := f.tables[name]; ok && len(table.columns) == columnCount {
+		return table, nil
+	}
+
+	rows, err := f.source.QueryContext(ctx, `SELECT COLUMN_NAME, COLUMN_KEY = 'PRI', COLUMN_TYPE LIKE '%unsigned%', DATA_TYPE
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`, f.database, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	table := &mysqlTable{name: name}
+	for rows.Next() {
+		var column mysqlColumn
+		if err := rows.Scan(&column.name, &column.key, &column.unsigned, &column.dataType); err != nil {
+			return nil, fmt.Errorf("failed to read the columns of %s: %w", name, err)
+		}
+		table.columns = append(table.columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %w", name, err)
+	}
+	if len(table.columns) != columnCount {
+		return nil, fmt.Errorf("table %s has %d columns on the source but %d in the binlog event: its schema changed",
+			name, len(table.columns), columnCount)
+	}
+
+	f.tables[name] = table
+	return table, nil
+}
+
+type mysqlColumn struct {
+	name     string
+	key      bool
+	unsigned bool
+	dataType string
+}
+
+type mysqlTable struct {
+	name    string
+	columns []mysqlColumn
+}
+
+func (t *mysqlTable) hasKey() bool {
+	for _, column := range t.columns {
+		if column.key {
+			return true
+		}
+	}
+	return false
+}
+
+// upsert inserts the row, updating the row sharing its primary key when the change was already applied
+func (t *mysqlTable) upsert(row []interface{}) (string, []interface{}) {
+	var columns, placeholders, updates []string
+	args := make([]interface{}, 0, len(row))
+	for i, value := range row {
+		column := quoteMySQLIdentifier(t.columns[i].name)
+		columns = append(columns, column)
+		placeholders = append(placeholders, "?")
+		args = append(args, t.columns[i].value(value))
+		if !t.columns[i].key {
+			updates = append(updates, column+" = VALUES("+column+")")
+		}
+	}
+
+	insert := "INSERT"
+	suffix := ""
+	switch {
+	case !t.hasKey():
+		// Without primary key a replayed insert cannot be detected
+	case len(updates) == 0:
+		insert = "INSERT IGNORE"
+	default:
+		suffix = " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	return fmt.Sprintf("%s INTO %s (%s) VALUES (%s)%s", insert, quoteMySQLIdentifier(t.name),
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "), suffix), args
+}
+
+func (t *mysqlTable) update(before, after []interface{}) (string, []interface{}) {
+	var sets []string
+	var args []interface{}
+	for i, value := range after {
+		sets = append(sets, quoteMySQLIdentifier(t.columns[i].name)+" = ?")
+		args = append(args, t.columns[i].value(value))
+	}
+
+	where, args := t.where(before, args)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1", quoteMySQLIdentifier(t.name), strings.Join(sets, ", "), where), args
+}
+
+func (t *mysqlTable) delete(row []interface{}) (string, []interface{}) {
+	where, args := t.where(row, nil)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1", quoteMySQLIdentifier(t.name), where), args
+}
+
+// where identifies a row by its primary key or, without one, by all of its columns
+func (t *mysqlTable) where(row []interface{}, args []interface{}) (string, []interface{}) {
+	useKey := t.hasKey()
+
+	var conditions []string
+	for i, value := range row {
+		if useKey && !t.columns[i].key {
+			continue
+		}
+		conditions = append(conditions, quoteMySQLIdentifier(t.columns[i].name)+" <=> ?")
+		args = append(args, t.columns[i].value(value))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// value converts a decoded binlog value for the target. The binlog does not tell signedness, so
+// unsigned integers above the signed range come out negative.
+func (c mysqlColumn) value(v interface{}) interface{} {
+	if !c.unsigned {
+		return v
+	}
+
+	switch n := v.(type) {
+	case int8:
+		return uint8(n)
+	case int16:
+		return uint16(n)
+	case int32:
+		if c.dataType == "mediumint" {
+			return uint32(n) & 0xFFFFFF
+		}
+		return uint32(n)
+	case int64:
+		return uint64(n)
+	default:
+		return v
+	}
+}
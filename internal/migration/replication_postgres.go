@@ -0,0 +1,640 @@
+package migration
+
+import (
+	"context"
+	"data-migration/internal/config"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Application name of the sessions opened by migrationdb on the source
+const postgresApplicationName = "migrationdb"
+
+// Number of changes read from the replication slot per round trip; whole transactions are always returned
+const postgresChangeBatch = 10000
+
+// postgresFollower consumes a pgoutput logical replication slot through the SQL interface and applies
+// the decoded changes to the target. The slot only advances once a transaction is committed on the target.
+type postgresFollower struct {
+	source *sql.DB
+	target *sql.DB
+	logger *config.Logger
+	opts   followOptions
+
+	relations map[uint32]*pgRelation
+}
+
+func newPostgresFollower(sourceConn, targetConn string, logger *config.Logger, opts followOptions) (*postgresFollower, error) {
+	// Named sessions are spared when the source is frozen for cutover
+	sourceConn = setQueryParams(sourceConn, [][2]string{{"application_name", postgresApplicationName}})
+	source, err := sql.Open("postgres", sourceConn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source connection: %w", err)
+	}
+	target, err := sql.Open("postgres", targetConn)
+	if err != nil {
+		source.Close()
+		return nil, fmt.Errorf("failed to create target connection: %w", err)
+	}
+
+	return &postgresFollower{
+		source:    source,
+		target:    target,
+		logger:    logger,
+		opts:      opts,
+		relations: make(map[uint32]*pgRelation),
+	}, nil
+}
+
+func (f *postgresFollower) Prepare(ctx context.Context) error {
+	var walLevel string
+	if err := f.source.QueryRowContext(ctx, "SHOW wal_level").Scan(&walLevel); err != nil {
+		return fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	if walLevel != "logical" {
+		return fmt.Errorf("following changes requires wal_level=logical on the source (currently %s)", walLevel)
+	}
+
+	if f.opts.resume {
+		var plugin string
+		err := f.source.QueryRowContext(ctx, "SELECT plugin FROM pg_replication_slots WHERE slot_name = $1", f.opts.slot).Scan(&plugin)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("replication slot %s does not exist, it is created by --follow", f.opts.slot)
+		case err != nil:
+			return fmt.Errorf("failed to look up replication slot: %w", err)
+		case plugin != "pgoutput":
+			return fmt.Errorf("replication slot %s uses the %s plugin, expected pgoutput", f.opts.slot, plugin)
+		}
+		f.logger.Infow("Resuming from logical replication slot", "slot", f.opts.slot)
+		return nil
+	}
+
+	var exists bool
+	err := f.source.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", f.opts.slot).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up publication: %w", err)
+	}
+	if !exists {
+		if err := f.checkReplicaIdentity(ctx); err != nil {
+			return err
+		}
+		if _, err := f.source.ExecContext(ctx, "CREATE PUBLICATION "+quotePostgresIdentifier(f.opts.slot)+" FOR ALL TABLES"); err != nil {
+			return fmt.Errorf("failed to create publication %s: %w", f.opts.slot, err)
+		}
+		f.logger.Infow("Created publication", "publication", f.opts.slot)
+	}
+
+	var plugin sql.NullString
+	err = f.source.QueryRowContext(ctx, "SELECT plugin FROM pg_replication_slots WHERE slot_name = $1", f.opts.slot).Scan(&plugin)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := f.source.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", f.opts.slot); err != nil {
+			return fmt.Errorf("failed to create replication slot %s: %w", f.opts.slot, err)
+		}
+		f.logger.Infow("Created logical replication slot", "slot", f.opts.slot)
+	case err != nil:
+		return fmt.Errorf("failed to look up replication slot: %w", err)
+	case plugin.String != "pgoutput":
+		return fmt.Errorf("replication slot %s uses the %s plugin, expected pgoutput", f.opts.slot, plugin.String)
+	default:
+		f.logger.Infow("Reusing existing logical replication slot", "slot", f.opts.slot)
+	}
+
+	return nil
+}
+
+// checkReplicaIdentity refuses to publish the source when some of its tables have no replica identity:
+// once published, their UPDATE and DELETE statements fail on the source
+func (f *postgresFollower) checkReplicaIdentity(ctx context.Context) error {
+	rows, err := f.source.QueryContext(ctx, `SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r' AND c.relpersistence = 'p'
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND (c.relreplident = 'n'
+				OR (c.relreplident = 'd' AND NOT EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = c.oid AND i.indisprimary))
+				OR (c.relreplident = 'i' AND NOT EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = c.oid AND i.indisreplident)))
+		ORDER BY n.nspname, c.relname`)
+	if err != nil {
+		return fmt.Errorf("failed to check replica identities: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			return fmt.Errorf("failed to check replica identities: %w", err)
+		}
+		tables = append(tables, quotePostgresIdentifier(schema)+"."+quotePostgresIdentifier(name))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check replica identities: %w", err)
+	}
+
+	if len(tables) > 0 {
+		return fmt.Errorf("cannot follow changes: once published, tables without primary key or replica identity reject "+
+			"UPDATE and DELETE on the source (add a primary key or run ALTER TABLE ... REPLICA IDENTITY FULL): %s",
+			strings.Join(tables, ", "))
+	}
+	return nil
+}
+
+func (f *postgresFollower) Follow(ctx context.Context, report func(FollowStatus)) error {
+	status := FollowStatus{LagBytes: -1}
+
+	for {
+		// WAL written before this point and not returned by the slot holds no change to apply
+		var walPosition sql.NullString
+		if err := f.source.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&walPosition); err != nil {
+			return fmt.Errorf("failed to read source WAL position: %w", err)
+		}
+
+		changes, err := f.peek(ctx)
+		if err != nil {
+			return err
+		}
+
+		applied, err := f.apply(ctx, changes, &status)
+		if err != nil {
+			return err
+		}
+		status.Applied += applied
+
+		if len(changes) == 0 && walPosition.Valid {
+			if err := f.advance(ctx, walPosition.String); err != nil {
+				return err
+			}
+			status.Position = walPosition.String
+		}
+
+		status.LagBytes = f.lagBytes(ctx)
+		status.CaughtUp = len(changes) < postgresChangeBatch
+		if status.CaughtUp {
+			status.Lag = 0
+		}
+		report(status)
+
+		if status.CaughtUp {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(f.opts.interval):
+			}
+		}
+	}
+}
+
+// Cleanup drops the replication slot, which otherwise retains WAL on the source, and the publication
+func (f *postgresFollower) Cleanup(ctx context.Context) error {
+	// The source may have been made read-only for cutover, which applies to new sessions
+	conn, err := f.source.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET default_transaction_read_only = off"); err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", f.opts.slot, err)
+	}
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = $1", f.opts.slot)
+	if err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", f.opts.slot, err)
+	}
+	if _, err := conn.ExecContext(ctx, "DROP PUBLICATION IF EXISTS "+quotePostgresIdentifier(f.opts.slot)); err != nil {
+		return fmt.Errorf("failed to drop publication %s: %w", f.opts.slot, err)
+	}
+
+	f.logger.Infow("Dropped replication slot and publication", "slot", f.opts.slot)
+	return nil
+}
+
+func (f *postgresFollower) Close() error {
+	f.target.Close()
+	return f.source.Close()
+}
+
+// pgChange is one pgoutput message read from the slot
+type pgChange struct {
+	lsn  string
+	data []byte
+}
+
+// peek reads the pending changes without consuming them; the slot is advanced once they are applied
+func (f *postgresFollower) peek(ctx context.Context) ([]pgChange, error) {
+	rows, err := f.source.QueryContext(ctx, `SELECT lsn::text, data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2,
+		'proto_version', '1', 'publication_names', $3)`, f.opts.slot, postgresChangeBatch, f.opts.slot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read changes from slot %s: %w", f.opts.slot, err)
+	}
+	defer rows.Close()
+
+	var changes []pgChange
+	for rows.Next() {
+		var change pgChange
+		if err := rows.Scan(&change.lsn, &change.data); err != nil {
+			return nil, fmt.Errorf("failed to read change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// apply applies every transaction of changes in its own target transaction, advancing the slot after each commit
+func (f *postgresFollower) apply(ctx context.Context, changes []pgChange, status *FollowStatus) (int64, error) {
+	var tx *sql.Tx
+	var applied, pending int64
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, change := range changes {
+		msg := pgMessage(change.data)
+		if len(msg) == 0 {
+			continue
+		}
+
+		switch msg[0] {
+		case 'B':
+			var err error
+			if tx, err = f.target.BeginTx(ctx, nil); err != nil {
+				return applied, fmt.Errorf("failed to start target transaction: %w", err)
+			}
+			pending = 0
+		case 'C':
+			if tx == nil {
+				continue
+			}
+			commit, err := msg.commit()
+			if err != nil {
+				return applied, err
+			}
+			if err := tx.Commit(); err != nil {
+				return applied, fmt.Errorf("failed to commit target transaction: %w", err)
+			}
+			tx = nil
+			if err := f.advance(ctx, commit.endLSN); err != nil {
+				return applied, err
+			}
+			applied += pending
+			status.Position = commit.endLSN
+			status.Lag = time.Since(commit.timestamp)
+		case 'R':
+			rel, err := msg.relation()
+			if err != nil {
+				return applied, err
+			}
+			f.relations[rel.id] = rel
+		case 'I', 'U', 'D', 'T':
+			if tx == nil {
+				return applied, fmt.Errorf("change at %s outside of a transaction", change.lsn)
+			}
+			n, err := f.applyChange(ctx, tx, msg)
+			if err != nil {
+				return applied, fmt.Errorf("failed to apply change at %s: %w", change.lsn, err)
+			}
+			pending += n
+		}
+	}
+
+	return applied, nil
+}
+
+// advance confirms to the slot that the changes up to lsn were applied, releasing their WAL
+func (f *postgresFollower) advance(ctx context.Context, lsn string) error {
+	if _, err := f.source.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", f.opts.slot, lsn); err != nil {
+		return fmt.Errorf("failed to advance replication slot: %w", err)
+	}
+	return nil
+}
+
+func (f *postgresFollower) applyChange(ctx context.Context, tx *sql.Tx, msg pgMessage) (int64, error) {
+	if msg[0] == 'T' {
+		relIDs, options, err := msg.truncate()
+		if err != nil {
+			return 0, err
+		}
+		tables := make([]string, 0, len(relIDs))
+		for _, id := range relIDs {
+			rel, ok := f.relations[id]
+			if !ok {
+				return 0, fmt.Errorf("unknown relation %d", id)
+			}
+			tables = append(tables, rel.qualifiedName())
+		}
+		statement := "TRUNCATE " + strings.Join(tables, ", ")
+		if options&2 != 0 {
+			statement += " RESTART IDENTITY"
+		}
+		if options&1 != 0 {
+			statement += " CASCADE"
+		}
+		_, err = tx.ExecContext(ctx, statement)
+		return 1, err
+	}
+
+	change, err := msg.rowChange()
+	if err != nil {
+		return 0, err
+	}
+	rel, ok := f.relations[change.relID]
+	if !ok {
+		return 0, fmt.Errorf("unknown relation %d", change.relID)
+	}
+
+	var statement string
+	var args []interface{}
+	switch msg[0] {
+	case 'I':
+		statement, args = rel.upsert(change.newTuple)
+	case 'U':
+		old := change.oldTuple
+		if old == nil {
+			// The key did not change, so the new tuple identifies the row
+			old = change.newTuple
+		}
+		statement, args = rel.update(old, change.newTuple)
+	case 'D':
+		statement, args = rel.delete(change.oldTuple)
+	}
+
+	_, err = tx.ExecContext(ctx, statement, args...)
+	return 1, err
+}
+
+// lagBytes returns the WAL left to decode by the slot, or -1 when unknown (e.g. on a standby)
+func (f *postgresFollower) lagBytes(ctx context.Context) int64 {
+	var lag sql.NullInt64
+	err := f.source.QueryRowContext(ctx, `SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn)::bigint
+		FROM pg_replication_slots WHERE slot_name = $1`, f.opts.slot).Scan(&lag)
+	if err != nil || !lag.Valid {
+		return -1
+	}
+	return lag.Int64
+}
+
+// pgRelation is the description of a table sent by pgoutput before its first change
+type pgRelation struct {
+	id     uint32
+	schema string
+	name   string
+	// identity is the replica identity setting: 'd' primary key, 'i' index, 'f' full or 'n' nothing
+	identity byte
+	columns  []string
+	key      []bool
+}
+
+func (r *pgRelation) qualifiedName() string {
+	return quotePostgresIdentifier(r.schema) + "." + quotePostgresIdentifier(r.name)
+}
+
+// hasKey reports whether the key columns are those of a unique index. With REPLICA IDENTITY FULL,
+// pgoutput flags every column as part of the key.
+func (r *pgRelation) hasKey() bool {
+	if r.identity != 'd' && r.identity != 'i' {
+		return false
+	}
+	for _, key := range r.key {
+		if key {
+			return true
+		}
+	}
+	return false
+}
+
+// upsert inserts the tuple, updating the row sharing its key when the change was already applied
+func (r *pgRelation) upsert(tuple []pgValue) (string, []interface{}) {
+	var columns, placeholders, updates, keys []string
+	var args []interface{}
+	useKey := r.hasKey()
+	for i, value := range tuple {
+		column := quotePostgresIdentifier(r.columns[i])
+		args = append(args, value.arg())
+		columns = append(columns, column)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		if useKey && r.key[i] {
+			keys = append(keys, column)
+		} else {
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", r.qualifiedName(),
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	switch {
+	case len(keys) == 0:
+		// Without a unique replica identity key a replayed insert cannot be detected
+	case len(updates) == 0:
+		statement += fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(keys, ", "))
+	default:
+		statement += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(updates, ", "))
+	}
+	return statement, args
+}
+
+func (r *pgRelation) update(old, tuple []pgValue) (string, []interface{}) {
+	var sets []string
+	var args []interface{}
+	for i, value := range tuple {
+		if value.kind == 'u' {
+			// Unchanged TOAST value, not sent by the source
+			continue
+		}
+		args = append(args, value.arg())
+		sets = append(sets, fmt.Sprintf("%s = $%d", quotePostgresIdentifier(r.columns[i]), len(args)))
+	}
+
+	where, args := r.where(old, args)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", r.qualifiedName(), strings.Join(sets, ", "), where), args
+}
+
+func (r *pgRelation) delete(old []pgValue) (string, []interface{}) {
+	where, args := r.where(old, nil)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", r.qualifiedName(), where), args
+}
+
+// where identifies a row by its key columns or, with REPLICA IDENTITY FULL, by all the columns of its old tuple
+func (r *pgRelation) where(tuple []pgValue, args []interface{}) (string, []interface{}) {
+	useKey := r.hasKey()
+
+	var conditions []string
+	for i, value := range tuple {
+		if (useKey && !r.key[i]) || value.kind == 'u' {
+			continue
+		}
+		args = append(args, value.arg())
+		conditions = append(conditions, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", quotePostgresIdentifier(r.columns[i]), len(args)))
+	}
+
+	condition := strings.Join(conditions, " AND ")
+	if !useKey {
+		// Rows without key may be duplicated: touch only one of them, like the source did
+		condition = fmt.Sprintf("ctid = (SELECT ctid FROM %s WHERE %s LIMIT 1)", r.qualifiedName(), condition)
+	}
+	return condition, args
+}
+
+// pgValue is a column of a pgoutput tuple: 'n' for null, 'u' for an unchanged TOAST value, 't' for text
+type pgValue struct {
+	kind byte
+	text string
+}
+
+func (v pgValue) arg() interface{} {
+	if v.kind == 'n' {
+		return nil
+	}
+	return v.text
+}
+
+type pgCommit struct {
+	endLSN    string
+	timestamp time.Time
+}
+
+type pgRowChange struct {
+	relID    uint32
+	oldTuple []pgValue
+	newTuple []pgValue
+}
+
+// pgMessage is a message of the pgoutput protocol, version 1
+type pgMessage []byte
+
+var errShortMessage = errors.New("truncated pgoutput message")
+
+// pgEpoch is the origin of the PostgreSQL timestamps
+var pgEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func (m pgMessage) commit() (pgCommit, error) {
+	// Byte1('C'), Int8 flags, Int64 commit LSN, Int64 end LSN, Int64 commit timestamp
+	if len(m) < 26 {
+		return pgCommit{}, errShortMessage
+	}
+	endLSN := binary.BigEndian.Uint64(m[10:18])
+	micros := int64(binary.BigEndian.Uint64(m[18:26]))
+	return pgCommit{
+		endLSN:    fmt.Sprintf("%X/%X", endLSN>>32, uint32(endLSN)),
+		timestamp: pgEpoch.Add(time.Duration(micros) * time.Microsecond),
+	}, nil
+}
+
+func (m pgMessage) relation() (*pgRelation, error) {
+	r := &pgReader{buf: m[1:]}
+	rel := &pgRelation{id: r.uint32()}
+	rel.schema = r.string()
+	rel.name = r.string()
+	rel.identity = r.byte()
+	count := int(r.uint16())
+	for i := 0; i < count && r.err == nil; i++ {
+		flags := r.byte()
+		rel.columns = append(rel.columns, r.string())
+		rel.key = append(rel.key, flags&1 != 0)
+		r.uint32() // type OID
+		r.uint32() // type modifier
+	}
+	return rel, r.err
+}
+
+func (m pgMessage) rowChange() (pgRowChange, error) {
+	r := &pgReader{buf: m[1:]}
+	change := pgRowChange{relID: r.uint32()}
+	for r.err == nil && len(r.buf) > 0 {
+		switch kind := r.byte(); kind {
+		case 'K', 'O':
+			change.oldTuple = r.tuple()
+		case 'N':
+			change.newTuple = r.tuple()
+		default:
+			return change, fmt.Errorf("unexpected tuple type %q in pgoutput message", kind)
+		}
+	}
+	return change, r.err
+}
+
+func (m pgMessage) truncate() ([]uint32, byte, error) {
+	r := &pgReader{buf: m[1:]}
+	count := int(r.uint32())
+	options := r.byte()
+	ids := make([]uint32, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		ids = append(ids, r.uint32())
+	}
+	return ids, options, r.err
+}
+
+// pgReader decodes the fields of a pgoutput message, remembering the first error
+type pgReader struct {
+	buf []byte
+	err error
+}
+
+func (r *pgReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := strings.IndexByte(string(r.buf), 0)
+	if end < 0 {
+		r.err = errShortMessage
+		return ""
+	}
+	s := string(r.buf[:end])
+	r.buf = r.buf[end+1:]
+	return s
+}
+
+func (r *pgReader) tuple() []pgValue {
+	count := int(r.uint16())
+	values := make([]pgValue, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		value := pgValue{kind: r.byte()}
+		if value.kind == 't' {
+			length := int(r.uint32())
+			value.text = string(r.next(length))
+		}
+		values = append(values, value)
+	}
+	return values
+}
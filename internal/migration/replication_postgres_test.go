@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPgRelationStatements(t *testing.T) {
+	text := func(s string) pgValue { return pgValue{kind: 't', text: s} }
+	oldTuple := []pgValue{text("1"), text("old"), {kind: 'n'}}
+	newTuple := []pgValue{text("1"), text("new"), {kind: 'u'}}
+
+	tests := []struct {
+		name       string
+		identity   byte
+		key        []bool
+		wantUpsert string
+		wantUpdate string
+		wantDelete string
+	}{
+		{
+			name:       "primary key",
+			identity:   'd',
+			key:        []bool{true, false, false},
+			wantUpsert: `INSERT INTO "public"."t" ("id", "name", "doc") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "doc" = EXCLUDED."doc"`,
+			wantUpdate: `UPDATE "public"."t" SET "id" = $1, "name" = $2 WHERE "id" IS NOT DISTINCT FROM $3`,
+			wantDelete: `DELETE FROM "public"."t" WHERE "id" IS NOT DISTINCT FROM $1`,
+		},
+		{
+			name:       "replica identity index covering every column",
+			identity:   'i',
+			key:        []bool{true, true, true},
+			wantUpsert: `INSERT INTO "public"."t" ("id", "name", "doc") VALUES ($1, $2, $3) ON CONFLICT ("id", "name", "doc") DO NOTHING`,
+			wantUpdate: `UPDATE "public"."t" SET "id" = $1, "name" = $2 WHERE "id" IS NOT DISTINCT FROM $3 AND "name" IS NOT DISTINCT FROM $4 AND "doc" IS NOT DISTINCT FROM $5`,
+			wantDelete: `DELETE FROM "public"."t" WHERE "id" IS NOT DISTINCT FROM $1 AND "name" IS NOT DISTINCT FROM $2 AND "doc" IS NOT DISTINCT FROM $3`,
+		},
+		{
+			name:       "replica identity full",
+			identity:   'f',
+			key:        []bool{true, true, true},
+			wantUpsert: `INSERT INTO "public"."t" ("id", "name", "doc") VALUES ($1, $2, $3)`,
+			wantUpdate: `UPDATE "public"."t" SET "id" = $1, "name" = $2 WHERE ctid = (SELECT ctid FROM "public"."t" WHERE "id" IS NOT DISTINCT FROM $3 AND "name" IS NOT DISTINCT FROM $4 AND "doc" IS NOT DISTINCT FROM $5 LIMIT 1)`,
+			wantDelete: `DELETE FROM "public"."t" WHERE ctid = (SELECT ctid FROM "public"."t" WHERE "id" IS NOT DISTINCT FROM $1 AND "name" IS NOT DISTINCT FROM $2 AND "doc" IS NOT DISTINCT FROM $3 LIMIT 1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel := &pgRelation{schema: "public", name: "t", identity: tt.identity, columns: []string{"id", "name", "doc"}, key: tt.key}
+
+			if got, args := rel.upsert([]pgValue{text("1"), text("new"), {kind: 'n'}}); got != tt.wantUpsert || len(args) != 3 || args[2] != nil {
+				t.Errorf("upsert() = %s %v, want %s", got, args, tt.wantUpsert)
+			}
+			if got, _ := rel.update(oldTuple, newTuple); got != tt.wantUpdate {
+				t.Errorf("update() = %s, want %s", got, tt.wantUpdate)
+			}
+			if got, _ := rel.delete(oldTuple); got != tt.wantDelete {
+				t.Errorf("delete() = %s, want %s", got, tt.wantDelete)
+			}
+		})
+	}
+}
+
+func TestPgMessageRelation(t *testing.T) {
+	msg := pgMessage("R" +
+		"\x00\x00\x40\x00" + "public\x00" + "orders\x00" + "f" + "\x00\x02" +
+		"\x01" + "id\x00" + "\x00\x00\x00\x17" + "\xff\xff\xff\xff" +
+		"\x01" + "total\x00" + "\x00\x00\x06\xa4" + "\xff\xff\xff\xff")
+
+	rel, err := msg.relation()
+	if err != nil {
+		t.Fatalf("relation() error = %v", err)
+	}
+	if rel.id != 0x4000 || rel.schema != "public" || rel.name != "orders" || rel.identity != 'f' {
+		t.Errorf("relation() = %d %s.%s identity %q", rel.id, rel.schema, rel.name, rel.identity)
+	}
+	if !slices.Equal(rel.columns, []string{"id", "total"}) || !slices.Equal(rel.key, []bool{true, true}) {
+		t.Errorf("columns = %v key %v", rel.columns, rel.key)
+	}
+	if rel.hasKey() {
+		t.Error("hasKey() = true under REPLICA IDENTITY FULL")
+	}
+
+	if _, err := msg[:20].relation(); err == nil {
+		t.Error("relation() of a truncated message succeeded")
+	}
+}
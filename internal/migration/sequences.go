@@ -0,0 +1,166 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SequenceReset is a sequence or AUTO_INCREMENT counter moved past the existing rows
+type SequenceReset struct {
+	// Table is the table whose column the counter feeds
+	Table string
+	// Column is the column filled by the counter
+	Column string
+	// Sequence names the PostgreSQL sequence, empty for AUTO_INCREMENT
+	Sequence string
+	// From is the value the counter would have returned next
+	From int64
+	// To is the next value returned now, the maximum of the column plus one
+	To int64
+}
+
+// ResetSequences moves the counters feeding the columns of the database behind connString past their
+// maximum value, so that new rows do not collide with the copied ones. Counters are never moved back.
+// MongoDB has no counters, nothing is done.
+func ResetSequences(ctx context.Context, dbType string, connString string) ([]SequenceReset, error) {
+	switch DatabaseType(dbType) {
+	case Postgres:
+		return resetPostgresSequences(ctx, connString)
+	case MySQL:
+		return resetMySQLAutoIncrements(ctx, connString)
+	case MongoDB:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+func resetPostgresSequences(ctx context.Context, connString string) ([]SequenceReset, error) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	// Sequences owned by a serial ('a') or identity ('i') column
+	rows, err := db.QueryContext(ctx, `SELECT s.oid::regclass::text, t.oid::regclass::text, a.attname
+		FROM pg_class s
+		JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = s.oid
+			AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		JOIN pg_namespace n ON n.oid = s.relnamespace
+		WHERE s.relkind = 'S' AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+	var owned []SequenceReset
+	for rows.Next() {
+		var seq SequenceReset
+		if err := rows.Scan(&seq.Sequence, &seq.Table, &seq.Column); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read sequence: %w", err)
+		}
+		owned = append(owned, seq)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+
+	var resets []SequenceReset
+	for _, seq := range owned {
+		// regclass text output is already quoted where needed
+		var lastValue int64
+		var isCalled bool
+		if err := db.QueryRowContext(ctx, "SELECT last_value, is_called FROM "+seq.Sequence).Scan(&lastValue, &isCalled); err != nil {
+			return resets, fmt.Errorf("failed to read sequence %s: %w", seq.Sequence, err)
+		}
+		seq.From = lastValue
+		if isCalled {
+			seq.From++
+		}
+
+		var maxValue sql.NullInt64
+		query := fmt.Sprintf("SELECT max(%s)::bigint FROM %s", quotePostgresIdentifier(seq.Column), seq.Table)
+		if err := db.QueryRowContext(ctx, query).Scan(&maxValue); err != nil {
+			return resets, fmt.Errorf("failed to read the maximum of %s.%s: %w", seq.Table, seq.Column, err)
+		}
+		if !maxValue.Valid || maxValue.Int64 < seq.From {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, "SELECT setval($1::regclass, $2, true)", seq.Sequence, maxValue.Int64); err != nil {
+			return resets, fmt.Errorf("failed to reset sequence %s: %w", seq.Sequence, err)
+		}
+		seq.To = maxValue.Int64 + 1
+		resets = append(resets, seq)
+	}
+
+	return resets, nil
+}
+
+func resetMySQLAutoIncrements(ctx context.Context, connString string) ([]SequenceReset, error) {
+	dsn, err := MySQLDSN(connString)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	// MySQL 8 caches the AUTO_INCREMENT of information_schema.TABLES; older servers and MariaDB lack the setting
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	conn.ExecContext(ctx, "SET SESSION information_schema_stats_expiry = 0")
+
+	rows, err := conn.QueryContext(ctx, `SELECT c.TABLE_NAME, c.COLUMN_NAME, COALESCE(t.AUTO_INCREMENT, 1)
+		FROM information_schema.COLUMNS c
+		JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+		WHERE c.TABLE_SCHEMA = DATABASE() AND c.EXTRA LIKE '%auto_increment%' AND t.TABLE_TYPE = 'BASE TABLE'
+		ORDER BY c.TABLE_NAME`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AUTO_INCREMENT columns: %w", err)
+	}
+	var columns []SequenceReset
+	for rows.Next() {
+		var column SequenceReset
+		if err := rows.Scan(&column.Table, &column.Column, &column.From); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read AUTO_INCREMENT column: %w", err)
+		}
+		columns = append(columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list AUTO_INCREMENT columns: %w", err)
+	}
+
+	var resets []SequenceReset
+	for _, column := range columns {
+		var maxValue sql.NullInt64
+		query := fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteMySQLIdentifier(column.Column), quoteMySQLIdentifier(column.Table))
+		if err := conn.QueryRowContext(ctx, query).Scan(&maxValue); err != nil {
+			return resets, fmt.Errorf("failed to read the maximum of %s.%s: %w", column.Table, column.Column, err)
+		}
+		if !maxValue.Valid || maxValue.Int64 < column.From {
+			continue
+		}
+
+		column.To = maxValue.Int64 + 1
+		statement := fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", quoteMySQLIdentifier(column.Table), column.To)
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return resets, fmt.Errorf("failed to reset the AUTO_INCREMENT of %s: %w", column.Table, err)
+		}
+		resets = append(resets, column)
+	}
+
+	return resets, nil
+}
@@ -0,0 +1,493 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Number of referenced keys looked up per query while walking foreign keys
+const subsetBatchSize = 500
+
+// Number of rows buffered per table before they are written and their references followed
+const subsetFlushRows = 1000
+
+// Subset selects the rows of a root table, which are migrated together with every row they reference
+// through foreign keys, directly or not
+type Subset struct {
+	Table string
+	Where string
+	Limit int
+}
+
+var subsetPattern = regexp.MustCompile(`(?is)^\s*(\S+)(?:\s+where\s+(.+?))?(?:\s+limit\s+(\d+))?\s*$`)
+
+// ParseSubset parses a subset as "table [where predicate] [limit n]", e.g. "customers where region='eu' limit 100"
+func ParseSubset(s string) (Subset, error) {
+	match := subsetPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Subset{}, fmt.Errorf("invalid subset %q: expected \"table [where predicate] [limit n]\"", s)
+	}
+
+	subset := Subset{Table: match[1], Where: strings.TrimSpace(match[2])}
+	if match[3] != "" {
+		limit, err := strconv.Atoi(match[3])
+		if err != nil || limit <= 0 {
+			return Subset{}, fmt.Errorf("invalid subset limit %q", match[3])
+		}
+		subset.Limit = limit
+	}
+	return subset, nil
+}
+
+func (s Subset) String() string {
+	out := s.Table
+	if s.Where != "" {
+		out += " where " + s.Where
+	}
+	if s.Limit > 0 {
+		out += fmt.Sprintf(" limit %d", s.Limit)
+	}
+	return out
+}
+
+// subsetTable is a table of a subset dump, with its columns in table order
+type subsetTable struct {
+	// name is the table name as shown in logs, schema.table for PostgreSQL
+	name string
+	// quoted is the qualified and quoted table name
+	quoted  string
+	columns []subsetColumn
+	// key holds the indexes of the primary key columns, or of all columns without primary key
+	key        []int
+	primaryKey bool
+	parents    []subsetReference
+}
+
+type subsetColumn struct {
+	name string
+	// binary columns are written as hexadecimal literals by the MySQL dialect
+	binary bool
+}
+
+// subsetReference is a foreign key of a table to its parent table
+type subsetReference struct {
+	columns       []int
+	parent        *subsetTable
+	parentColumns []string
+}
+
+func (t *subsetTable) column(name string) int {
+	for i, column := range t.columns {
+		if column.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// subsetSchema collects the tables, primary keys and foreign keys read from information_schema
+type subsetSchema struct {
+	tables map[string]*subsetTable
+	// primary keys and foreign keys, keyed by table and by table and constraint
+	keys       map[string][]string
+	references map[string]*subsetForeignKey
+	order      []string
+}
+
+type subsetForeignKey struct {
+	table, parent          string
+	columns, parentColumns []string
+}
+
+func newSubsetSchema() *subsetSchema {
+	return &subsetSchema{
+		tables:     make(map[string]*subsetTable),
+		keys:       make(map[string][]string),
+		references: make(map[string]*subsetForeignKey),
+	}
+}
+
+func (s *subsetSchema) addColumn(table, quoted, column string, binary bool) {
+	t, ok := s.tables[table]
+	if !ok {
+		t = &subsetTable{name: table, quoted: quoted}
+		s.tables[table] = t
+	}
+	t.columns = append(t.columns, subsetColumn{name: column, binary: binary})
+}
+
+func (s *subsetSchema) addKeyColumn(table, column string) {
+	s.keys[table] = append(s.keys[table], column)
+}
+
+func (s *subsetSchema) addReference(table, constraint, column, parent, parentColumn string) {
+	id := table + "\x00" + constraint
+	fk, ok := s.references[id]
+	if !ok {
+		fk = &subsetForeignKey{table: table, parent: parent}
+		s.references[id] = fk
+		s.order = append(s.order, id)
+	}
+	fk.columns = append(fk.columns, column)
+	fk.parentColumns = append(fk.parentColumns, parentColumn)
+}
+
+// resolve links the keys and references to the tables
+func (s *subsetSchema) resolve() map[string]*subsetTable {
+	for name, t := range s.tables {
+		for _, column := range s.keys[name] {
+			if i := t.column(column); i >= 0 {
+				t.key = append(t.key, i)
+			}
+		}
+		t.primaryKey = len(t.key) == len(s.keys[name]) && len(t.key) > 0
+		if !t.primaryKey {
+			// Without a usable primary key, rows are told apart by their whole content
+			t.key = t.key[:0]
+			for i := range t.columns {
+				t.key = append(t.key, i)
+			}
+		}
+	}
+
+	for _, id := range s.order {
+		fk := s.references[id]
+		t, parent := s.tables[fk.table], s.tables[fk.parent]
+		if t == nil || parent == nil {
+			continue
+		}
+		ref := subsetReference{parent: parent, parentColumns: fk.parentColumns}
+		for _, column := range fk.columns {
+			ref.columns = append(ref.columns, t.column(column))
+		}
+		if !containsInt(ref.columns, -1) {
+			t.parents = append(t.parents, ref)
+		}
+	}
+
+	return s.tables
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// subsetDialect is the database specific part of a subset dump
+type subsetDialect interface {
+	// selectColumn returns the select expression of a column, whose values are read as text
+	selectColumn(name string) string
+	quote(name string) string
+	placeholder(n int) string
+	// writeRows writes rows of t in a form the restore tool loads
+	writeRows(w *bufio.Writer, t *subsetTable, rows [][]sql.NullString) error
+}
+
+// subsetWalker writes the rows of a subset, following the foreign keys of every written row to the
+// rows it references. All queries run in tx, so the subset is read from a single snapshot.
+type subsetWalker struct {
+	tx       *sql.Tx
+	dialect  subsetDialect
+	out      *bufio.Writer
+	progress TableProgress
+
+	seen      map[*subsetTable]map[string]bool
+	requested map[string]bool
+	pending   []*subsetFetch
+	started   []*subsetTable
+}
+
+// subsetFetch is a lookup of referenced rows of a parent table by the referenced columns
+type subsetFetch struct {
+	table   *subsetTable
+	columns []string
+	values  [][]string
+}
+
+func newSubsetWalker(tx *sql.Tx, dialect subsetDialect, out *bufio.Writer, progress TableProgress) *subsetWalker {
+	return &subsetWalker{
+		tx:        tx,
+		dialect:   dialect,
+		out:       out,
+		progress:  progress,
+		seen:      make(map[*subsetTable]map[string]bool),
+		requested: make(map[string]bool),
+	}
+}
+
+// walk writes the rows selected by subset from root, then the rows they reference
+func (s *subsetWalker) walk(ctx context.Context, root *subsetTable, subset Subset) error {
+	query := "SELECT " + s.selectList(root) + " FROM " + root.quoted
+	if subset.Where != "" {
+		query += " WHERE " + subset.Where
+	}
+	if subset.Limit > 0 {
+		// A stable order, so that the limit picks the same rows on every run
+		var order []string
+		for _, i := range root.key {
+			order = append(order, s.dialect.quote(root.columns[i].name))
+		}
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(order, ", "), subset.Limit)
+	}
+	if err := s.fetch(ctx, root, query, nil); err != nil {
+		return err
+	}
+
+	for len(s.pending) > 0 {
+		f := s.pending[0]
+		if len(f.values) == 0 {
+			s.pending = s.pending[1:]
+			continue
+		}
+		batch := f.values
+		if len(batch) > subsetBatchSize {
+			batch = batch[:subsetBatchSize]
+		}
+		f.values = f.values[len(batch):]
+
+		query, args := s.lookup(f.table, f.columns, batch)
+		if err := s.fetch(ctx, f.table, query, args); err != nil {
+			return err
+		}
+	}
+
+	if s.progress != nil {
+		for _, t := range s.started {
+			s.progress.TableDone(t.name)
+		}
+	}
+	return nil
+}
+
+// copyRows writes the rows of t matching where, or all of them, in primary key order. Their
+// references are not followed.
+func (s *subsetWalker) copyRows(ctx context.Context, t *subsetTable, where string) error {
+	query := "SELECT " + s.selectList(t) + " FROM " + t.quoted
+	if where != "" {
+		query += " WHERE " + where
+	}
+	if t.primaryKey {
+		var order []string
+		for _, i := range t.key {
+			order = append(order, s.dialect.quote(t.columns[i].name))
+		}
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+
+	rows, err := s.tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to select rows of %s: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	if s.progress != nil {
+		s.progress.TableStarted(t.name)
+	}
+	var batch [][]sql.NullString
+	for rows.Next() {
+		row, err := scanSubsetRow(rows, t)
+		if err != nil {
+			return err
+		}
+		if batch = append(batch, row); len(batch) == subsetFlushRows {
+			if err := s.dialect.writeRows(s.out, t, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to select rows of %s: %w", t.name, err)
+	}
+	if len(batch) > 0 {
+		if err := s.dialect.writeRows(s.out, t, batch); err != nil {
+			return err
+		}
+	}
+	if s.progress != nil {
+		s.progress.TableDone(t.name)
+	}
+	return nil
+}
+
+func scanSubsetRow(rows *sql.Rows, t *subsetTable) ([]sql.NullString, error) {
+	row := make([]sql.NullString, len(t.columns))
+	dest := make([]interface{}, len(row))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to read row of %s: %w", t.name, err)
+	}
+	return row, nil
+}
+
+func (s *subsetWalker) selectList(t *subsetTable) string {
+	columns := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		columns[i] = s.dialect.selectColumn(column.name)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// lookup returns the query reading the rows of t whose columns hold one of the values
+func (s *subsetWalker) lookup(t *subsetTable, columns []string, values [][]string) (string, []interface{}) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = s.dialect.quote(column)
+	}
+
+	args := make([]interface{}, 0, len(values)*len(columns))
+	tuples := make([]string, len(values))
+	for i, tuple := range values {
+		placeholders := make([]string, len(tuple))
+		for j, value := range tuple {
+			args = append(args, value)
+			placeholders[j] = s.dialect.placeholder(len(args))
+		}
+		tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	return fmt.Sprintf("SELECT %s FROM %s WHERE (%s) IN (%s)",
+		s.selectList(t), t.quoted, strings.Join(quoted, ", "), strings.Join(tuples, ", ")), args
+}
+
+// fetch writes the rows returned by query that were not written yet and queues their references
+func (s *subsetWalker) fetch(ctx context.Context, t *subsetTable, query string, args []interface{}) error {
+	rows, err := s.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to select rows of %s: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	seen := s.seen[t]
+	if seen == nil {
+		seen = make(map[string]bool)
+		s.seen[t] = seen
+		if s.progress != nil {
+			s.progress.TableStarted(t.name)
+		}
+		s.started = append(s.started, t)
+	}
+
+	var batch [][]sql.NullString
+	for rows.Next() {
+		row, err := scanSubsetRow(rows, t)
+		if err != nil {
+			return err
+		}
+
+		key := rowIdentity(row, t.key)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if batch = append(batch, row); len(batch) == subsetFlushRows {
+			if err := s.emit(t, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to select rows of %s: %w", t.name, err)
+	}
+
+	return s.emit(t, batch)
+}
+
+// emit writes rows and queues the lookup of the rows they reference
+func (s *subsetWalker) emit(t *subsetTable, rows [][]sql.NullString) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := s.dialect.writeRows(s.out, t, rows); err != nil {
+		return err
+	}
+
+	for _, ref := range t.parents {
+		f := &subsetFetch{table: ref.parent, columns: ref.parentColumns}
+		prefix := ref.parent.name + "\x00" + strings.Join(ref.parentColumns, "\x00") + "\x00"
+		for _, row := range rows {
+			key := rowKey(row, ref.columns)
+			if key == "" || s.requested[prefix+key] {
+				continue
+			}
+			s.requested[prefix+key] = true
+
+			tuple := make([]string, len(ref.columns))
+			for i, column := range ref.columns {
+				tuple[i] = row[column].String
+			}
+			f.values = append(f.values, tuple)
+		}
+		if len(f.values) > 0 {
+			s.pending = append(s.pending, f)
+		}
+	}
+	return nil
+}
+
+// rowIdentity identifies a row by the given columns, which may be NULL
+func rowIdentity(row []sql.NullString, columns []int) string {
+	var b strings.Builder
+	for _, column := range columns {
+		if row[column].Valid {
+			b.WriteString(strconv.Quote(row[column].String))
+		} else {
+			b.WriteString("NULL")
+		}
+	}
+	return b.String()
+}
+
+// rowKey identifies the row referenced through the given columns, or returns "" when one of them is
+// NULL and the row references nothing
+func rowKey(row []sql.NullString, columns []int) string {
+	var b strings.Builder
+	for _, column := range columns {
+		if !row[column].Valid {
+			return ""
+		}
+		b.WriteString(strconv.Quote(row[column].String))
+	}
+	return b.String()
+}
+
+// findSubsetTable returns a table by name. Table names without schema must be unambiguous;
+// PostgreSQL tables of the public schema are preferred.
+func findSubsetTable(tables map[string]*subsetTable, name string) (*subsetTable, error) {
+	if t, ok := tables[name]; ok {
+		return t, nil
+	}
+	if t, ok := tables["public."+name]; ok {
+		return t, nil
+	}
+
+	var matches []string
+	for key := range tables {
+		if strings.HasSuffix(key, "."+name) {
+			matches = append(matches, key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("table %s not found", name)
+	case 1:
+		return tables[matches[0]], nil
+	default:
+		sort.Strings(matches)
+		return nil, fmt.Errorf("table %s is ambiguous: %s", name, strings.Join(matches, ", "))
+	}
+}
@@ -0,0 +1,191 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Size above which the rows of a subset are split into several INSERT statements
+const mysqlSubsetStatementSize = 1024 * 1024
+
+// Data types written as hexadecimal literals
+var mysqlBinaryTypes = map[string]bool{
+	"binary": true, "varbinary": true, "tinyblob": true, "blob": true, "mediumblob": true, "longblob": true,
+	"bit": true, "geometry": true, "point": true, "linestring": true, "polygon": true, "multipoint": true,
+	"multilinestring": true, "multipolygon": true, "geometrycollection": true, "geomcollection": true,
+}
+
+// dumpSubset writes the schema of mysqldump --no-data followed by INSERT statements of the subset
+// rows, with the session settings of mysqldump. Foreign key checks are disabled while loading, as rows
+// come in no particular order.
+func (d *MySQLDumper) dumpSubset(ctx context.Context, w io.Writer) error {
+	conn, err := parseMySQLConn(d.connString)
+	if err != nil {
+		return err
+	}
+	if conn.DBName == "" {
+		return fmt.Errorf("the MySQL connection string must name the database to dump")
+	}
+	cfg, err := conn.driverConfig()
+	if err != nil {
+		return err
+	}
+	// Read every value as text, with TIMESTAMP columns in UTC like mysqldump
+	cfg.InterpolateParams = true
+	cfg.ParseTime = false
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start subset transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables, err := loadMySQLSubsetTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	root, err := findSubsetTable(tables, d.options.subset.Table)
+	if err != nil {
+		return err
+	}
+
+	schema := &MySQLDumper{connString: d.connString, options: dumpOptions{noData: true}}
+	if err := schema.Dump(ctx, w); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(w, 64*1024)
+	out.WriteString("SET NAMES utf8mb4;\nSET TIME_ZONE='+00:00';\nSET SQL_MODE='NO_AUTO_VALUE_ON_ZERO';\nSET FOREIGN_KEY_CHECKS=0;\n")
+	if err := newSubsetWalker(tx, mysqlSubset{}, out, d.options.progress).walk(ctx, root, *d.options.subset); err != nil {
+		return err
+	}
+	out.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	return out.Flush()
+}
+
+func loadMySQLSubsetTables(ctx context.Context, tx *sql.Tx) (map[string]*subsetTable, error) {
+	schema := newSubsetSchema()
+
+	rows, err := tx.QueryContext(ctx, `SELECT c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.EXTRA
+		FROM information_schema.COLUMNS c
+		JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+		WHERE c.TABLE_SCHEMA = DATABASE() AND t.TABLE_TYPE = 'BASE TABLE'
+		ORDER BY c.TABLE_NAME, c.ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	if err := scanSubsetRows(rows, 4, func(v []string) {
+		// Generated columns are computed again by the target; DEFAULT_GENERATED only marks a default expression
+		extra := strings.ToUpper(v[3])
+		if strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED") ||
+			strings.Contains(extra, "PERSISTENT GENERATED") {
+			return
+		}
+		schema.addColumn(v[0], quoteMySQLIdentifier(v[0]), v[1], mysqlBinaryTypes[strings.ToLower(v[2])])
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT TABLE_NAME, COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+	if err := scanSubsetRows(rows, 2, func(v []string) {
+		schema.addKeyColumn(v[0], v[1])
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	if err := scanSubsetRows(rows, 5, func(v []string) {
+		schema.addReference(v[0], v[1], v[2], v[3], v[4])
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+
+	return schema.resolve(), nil
+}
+
+// mysqlSubset reads values as text and writes them as INSERT statements in the mysqldump
+// --complete-insert format
+type mysqlSubset struct{}
+
+var mysqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+func (mysqlSubset) selectColumn(name string) string {
+	return quoteMySQLIdentifier(name)
+}
+
+func (mysqlSubset) quote(name string) string {
+	return quoteMySQLIdentifier(name)
+}
+
+func (mysqlSubset) placeholder(int) string {
+	return "?"
+}
+
+func (mysqlSubset) writeRows(w *bufio.Writer, t *subsetTable, rows [][]sql.NullString) error {
+	columns := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		columns[i] = quoteMySQLIdentifier(column.name)
+	}
+	header := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", t.quoted, strings.Join(columns, ", "))
+
+	size := 0
+	for n, row := range rows {
+		if n == 0 || size > mysqlSubsetStatementSize {
+			if n > 0 {
+				w.WriteString(";\n")
+			}
+			w.WriteString(header)
+			size = 0
+		} else {
+			w.WriteByte(',')
+		}
+
+		var b strings.Builder
+		b.WriteByte('(')
+		for i, value := range row {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			switch {
+			case !value.Valid:
+				b.WriteString("NULL")
+			case t.columns[i].binary && value.String != "":
+				b.WriteString("0x" + hex.EncodeToString([]byte(value.String)))
+			default:
+				b.WriteString("'" + mysqlStringEscaper.Replace(value.String) + "'")
+			}
+		}
+		b.WriteByte(')')
+		size += b.Len()
+		w.WriteString(b.String())
+	}
+
+	_, err := w.WriteString(";\n")
+	return err
+}
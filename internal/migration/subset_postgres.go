@@ -0,0 +1,248 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dumpSubset writes the schema and the subset rows as a plain SQL script: the pre-data section of
+// pg_dump (tables, types, sequences), COPY blocks of the selected rows, then the post-data section
+// (indexes, constraints), so that rows load in any order. pg_dump reuses the snapshot the rows are
+// read from.
+func (d *PostgresDumper) dumpSubset(ctx context.Context, w io.Writer) error {
+	db, tx, snapshot, err := d.snapshotTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	tables, err := loadPostgresSubsetTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	root, err := findSubsetTable(tables, d.options.subset.Table)
+	if err != nil {
+		return err
+	}
+
+	if err := d.schemaDumper("pre-data", snapshot).Dump(ctx, w); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(w, 64*1024)
+	if err := newSubsetWalker(tx, postgresSubset{}, out, d.options.progress).walk(ctx, root, *d.options.subset); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	return d.schemaDumper("post-data", snapshot).Dump(ctx, w)
+}
+
+// snapshotTx starts the read-only transaction rows are read in and returns its snapshot, which
+// pg_dump reuses: the snapshot of WithSnapshot, or a newly exported one
+func (d *PostgresDumper) snapshotTx(ctx context.Context) (*sql.DB, *sql.Tx, string, error) {
+	return beginPostgresSnapshotTx(ctx, d.connString, d.options.serializableDeferrable, d.options.snapshot)
+}
+
+// dumpFiltered writes a plain SQL dump whose filtered tables only hold the rows matching their
+// predicate: pg_dump writes the schema and the data of the other tables, and the rows of the filtered
+// tables are selected from the same snapshot and written as COPY blocks
+func (d *PostgresDumper) dumpFiltered(ctx context.Context, w io.Writer) error {
+	db, tx, snapshot, err := d.snapshotTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	tables, err := loadPostgresSubsetTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	filtered := make([]*subsetTable, len(d.options.filters))
+	for i, filter := range d.options.filters {
+		if filtered[i], err = findSubsetTable(tables, filter.Table); err != nil {
+			return err
+		}
+	}
+
+	parts := d.filteredParts(snapshot, filtered)
+	if err := parts[0].Dump(ctx, w); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(w, 64*1024)
+	walker := newSubsetWalker(tx, postgresSubset{}, out, d.options.progress)
+	for i, t := range filtered {
+		if err := walker.copyRows(ctx, t, d.options.filters[i].Where); err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	for _, part := range parts[1:] {
+		if err := part.Dump(ctx, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filteredParts returns the pg_dump runs around the filtered rows: the schema and the data of the
+// other tables, then the constraints and indexes. Data-only dumps have no schema sections.
+func (d *PostgresDumper) filteredParts(snapshot string, filtered []*subsetTable) []*PostgresDumper {
+	excluded := make([]string, len(filtered))
+	for i, t := range filtered {
+		excluded[i] = t.quoted
+	}
+
+	data := &PostgresDumper{connString: d.connString, options: dumpOptions{
+		dataOnly:    d.options.dataOnly,
+		progress:    d.options.progress,
+		snapshot:    snapshot,
+		excludeData: excluded,
+	}}
+	if d.options.dataOnly {
+		return []*PostgresDumper{data}
+	}
+
+	data.options.section = "data"
+	return []*PostgresDumper{d.schemaDumper("pre-data", snapshot), data, d.schemaDumper("post-data", snapshot)}
+}
+
+// schemaDumper returns the dumper of a schema section of a subset dump, in plain SQL with its DROP
+// statements since psql restores it
+func (d *PostgresDumper) schemaDumper(section, snapshot string) *PostgresDumper {
+	return &PostgresDumper{
+		connString: d.connString,
+		options:    dumpOptions{maskable: true, section: section, snapshot: snapshot},
+	}
+}
+
+func loadPostgresSubsetTables(ctx context.Context, tx *sql.Tx) (map[string]*subsetTable, error) {
+	schema := newSubsetSchema()
+
+	// Generated columns are computed again by the target
+	rows, err := tx.QueryContext(ctx, `SELECT c.table_schema, c.table_name, c.column_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE t.table_type = 'BASE TABLE' AND c.is_generated <> 'ALWAYS'
+			AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY c.table_schema, c.table_name, c.ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	if err := scanSubsetRows(rows, 3, func(v []string) {
+		schema.addColumn(v[0]+"."+v[1], quotePostgresIdentifier(v[0])+"."+quotePostgresIdentifier(v[1]), v[2], false)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT k.table_schema, k.table_name, k.column_name
+		FROM information_schema.table_constraints c
+		JOIN information_schema.key_column_usage k ON k.constraint_schema = c.constraint_schema
+			AND k.constraint_name = c.constraint_name AND k.table_name = c.table_name
+		WHERE c.constraint_type = 'PRIMARY KEY' AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY k.table_schema, k.table_name, k.ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+	if err := scanSubsetRows(rows, 3, func(v []string) {
+		schema.addKeyColumn(v[0]+"."+v[1], v[2])
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+
+	// Constraint names are only unique per table, so the keys are read from pg_constraint, whose
+	// conkey and confkey pair the referencing and referenced columns by position
+	rows, err = tx.QueryContext(ctx, `SELECT sn.nspname, s.relname, c.conname, sa.attname, pn.nspname, p.relname, pa.attname
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, parent_attnum, position)
+		JOIN pg_class s ON s.oid = c.conrelid
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_attribute sa ON sa.attrelid = c.conrelid AND sa.attnum = k.attnum
+		JOIN pg_class p ON p.oid = c.confrelid
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		JOIN pg_attribute pa ON pa.attrelid = c.confrelid AND pa.attnum = k.parent_attnum
+		WHERE c.contype = 'f' AND sn.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY sn.nspname, s.relname, c.conname, k.position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	if err := scanSubsetRows(rows, 7, func(v []string) {
+		schema.addReference(v[0]+"."+v[1], v[2], v[3], v[4]+"."+v[5], v[6])
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+
+	return schema.resolve(), nil
+}
+
+// scanSubsetRows reads rows of n text columns and closes them
+func scanSubsetRows(rows *sql.Rows, n int, add func([]string)) error {
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]string, n)
+		dest := make([]interface{}, n)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		add(values)
+	}
+	return rows.Err()
+}
+
+// postgresSubset reads values in their text representation and writes them as COPY blocks
+type postgresSubset struct{}
+
+var copyTextEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (postgresSubset) selectColumn(name string) string {
+	return quotePostgresIdentifier(name) + "::text"
+}
+
+func (postgresSubset) quote(name string) string {
+	return quotePostgresIdentifier(name)
+}
+
+func (postgresSubset) placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgresSubset) writeRows(w *bufio.Writer, t *subsetTable, rows [][]sql.NullString) error {
+	columns := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		columns[i] = quotePostgresIdentifier(column.name)
+	}
+	fmt.Fprintf(w, "COPY %s (%s) FROM stdin;\n", t.quoted, strings.Join(columns, ", "))
+
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				w.WriteByte('\t')
+			}
+			if value.Valid {
+				w.WriteString(copyTextEscaper.Replace(value.String))
+			} else {
+				w.WriteString(`\N`)
+			}
+		}
+		w.WriteByte('\n')
+	}
+
+	_, err := w.WriteString("\\.\n\n")
+	return err
+}
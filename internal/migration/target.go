@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TargetInfo summarizes what already lives in a target database
+type TargetInfo struct {
+	Objects int
+	Kind    string // "tables" or "collections"
+}
+
+// TargetNotEmptyError is returned when a migration would write into a non-empty target without opt-in
+type TargetNotEmptyError struct {
+	Info TargetInfo
+}
+
+func (e *TargetNotEmptyError) Error() string {
+	return fmt.Sprintf("target database is not empty (%d %s found); use --overwrite to replace its content or --merge to append to it",
+		e.Info.Objects, e.Info.Kind)
+}
+
+// ErrOverwriteDeclined is returned when the user refuses to overwrite a non-empty target
+var ErrOverwriteDeclined = errors.New("overwrite of non-empty target declined")
+
+// InspectTarget counts the user tables or collections already present in the target database
+func InspectTarget(ctx context.Context, dbType string, connString string) (TargetInfo, error) {
+	switch DatabaseType(dbType) {
+	case Postgres:
+		count, err := countSQLObjects(ctx, "postgres", connString, `SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema NOT IN ('pg_catalog', 'information_schema') AND table_schema NOT LIKE 'pg_toast%'`)
+		return TargetInfo{Objects: count, Kind: "tables"}, err
+	case MySQL:
+		dsn, err := MySQLDSN(connString)
+		if err != nil {
+			return TargetInfo{}, err
+		}
+		count, err := countSQLObjects(ctx, "mysql", dsn,
+			"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE()")
+		return TargetInfo{Objects: count, Kind: "tables"}, err
+	case MongoDB:
+		count, err := countMongoCollections(ctx, connString)
+		return TargetInfo{Objects: count, Kind: "collections"}, err
+	default:
+		return TargetInfo{}, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+func countSQLObjects(ctx context.Context, driver, dsn, query string) (int, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create database connection: %w", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to inspect target database: %w", err)
+	}
+
+	return count, nil
+}
+
+func countMongoCollections(ctx context.Context, connString string) (int, error) {
+	database, err := DatabaseName(connString)
+	if err != nil {
+		return 0, err
+	}
+
+	databases := []string{database}
+	if database == "" {
+		if databases, err = ListDatabases(ctx, string(MongoDB), connString); err != nil {
+			return 0, err
+		}
+	}
+
+	client, err := mongo.Connect(ctx, MongoClientOptions(connString))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create MongoDB client: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	count := 0
+	for _, db := range databases {
+		collections, err := client.Database(db).ListCollectionNames(ctx, bson.D{})
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect target database %s: %w", db, err)
+		}
+		count += len(collections)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TLSMode is the level of TLS protection required for a connection
+type TLSMode string
+
+const (
+	TLSDisable    TLSMode = "disable"
+	TLSRequire    TLSMode = "require"
+	TLSVerifyCA   TLSMode = "verify-ca"
+	TLSVerifyFull TLSMode = "verify-full"
+)
+
+// TLSOptions describes the TLS settings of one side of the migration
+type TLSOptions struct {
+	// Mode defaults to verify-full when a certificate file is given, otherwise the connection string decides
+	Mode     TLSMode
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// IsZero reports whether no TLS setting was given
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// ApplyTLS returns connString with the TLS options translated into the connection parameters of
+// the engine. Those parameters are understood by both the command-line tools and the Go drivers.
+func ApplyTLS(dbType DatabaseType, connString string, opts TLSOptions) (string, error) {
+	if opts.IsZero() {
+		return connString, nil
+	}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") && dbType != MongoDB {
+		return "", fmt.Errorf("a client certificate and its key must be given together")
+	}
+
+	mode := opts.Mode
+	if mode == "" && (opts.CAFile != "" || opts.CertFile != "") {
+		mode = TLSVerifyFull
+	}
+
+	var params [][2]string
+	switch dbType {
+	case Postgres:
+		if mode != "" {
+			params = append(params, [2]string{"sslmode", string(mode)})
+		}
+		params = append(params,
+			[2]string{"sslrootcert", opts.CAFile},
+			[2]string{"sslcert", opts.CertFile},
+			[2]string{"sslkey", opts.KeyFile},
+		)
+
+	case MySQL:
+		if mode != "" {
+			params = append(params, [2]string{"tls", mysqlTLSParams[mode]})
+		}
+		params = append(params,
+			[2]string{"ssl-ca", opts.CAFile},
+			[2]string{"ssl-cert", opts.CertFile},
+			[2]string{"ssl-key", opts.KeyFile},
+		)
+
+	case MongoDB:
+		// MongoDB reads the client certificate and its key from a single PEM file
+		if opts.KeyFile != "" && opts.KeyFile != opts.CertFile {
+			return "", fmt.Errorf("MongoDB expects the client certificate and key in one PEM file, pass it as the certificate only")
+		}
+
+		switch mode {
+		case TLSDisable:
+			params = append(params, [2]string{"tls", "false"})
+		case TLSRequire:
+			params = append(params, [2]string{"tls", "true"}, [2]string{"tlsInsecure", "true"})
+		case TLSVerifyCA:
+			params = append(params, [2]string{"tls", "true"}, [2]string{"tlsAllowInvalidHostnames", "true"})
+		case TLSVerifyFull, "":
+			params = append(params, [2]string{"tls", "true"})
+		}
+		params = append(params,
+			[2]string{"tlsCAFile", opts.CAFile},
+			[2]string{"tlsCertificateKeyFile", opts.CertFile},
+		)
+
+	default:
+		return "", fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	return setQueryParams(connString, params), nil
+}
+
+// mysqlTLSParams maps TLS modes to the tls parameter of MySQL connection strings. verify-ca is an
+// extension handled by parseMySQLConn, the other values are those of go-sql-driver.
+var mysqlTLSParams = map[TLSMode]string{
+	TLSDisable:    "false",
+	TLSRequire:    "skip-verify",
+	TLSVerifyCA:   "verify-ca",
+	TLSVerifyFull: "true",
+}
+
+// setQueryParams sets the non-empty parameters in the query of connString. The query is edited as
+// text so that connection strings url.Parse rejects, such as MongoDB seed lists, keep working.
+func setQueryParams(connString string, params [][2]string) string {
+	base, rawQuery, _ := strings.Cut(connString, "?")
+
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && replacesParam(name, params) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+
+	for _, param := range params {
+		if param[1] != "" {
+			// libpq does not decode '+' as a space, so spaces are percent-encoded
+			value := strings.ReplaceAll(url.QueryEscape(param[1]), "+", "%20")
+			kept = append(kept, param[0]+"="+value)
+		}
+	}
+
+	if len(kept) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(kept, "&")
+}
+
+// replacesParam reports whether params sets name, or its legacy ssl alias on MongoDB
+func replacesParam(name string, params [][2]string) bool {
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		if strings.EqualFold(param[0], name) || (param[0] == "tls" && name == "ssl") {
+			return true
+		}
+	}
+	return false
+}
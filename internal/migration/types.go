@@ -20,36 +20,221 @@ type Dumper interface {
 	GetType() DatabaseType
 }
 
+// Describer is implemented by dumpers and restorers that can print the command they run
+type Describer interface {
+	Describe() string
+}
+
+// NamespaceDumper is implemented by dumpers able to dump namespaces individually
+type NamespaceDumper interface {
+	Namespaces(ctx context.Context) ([]string, error)
+	DumpNamespace(ctx context.Context, ns string, w io.Writer) error
+}
+
 // Restorer defines the interface for database restore operations
 type Restorer interface {
 	Restore(ctx context.Context, r io.Reader) error
 	GetType() DatabaseType
 }
 
-func CreateDumper(dbType string, connStr string, useStdOut bool) (Dumper, error) {
+// DumperOption configures optional behaviour of a Dumper
+type DumperOption func(*dumpOptions)
+
+type dumpOptions struct {
+	dataOnly bool
+	maskable bool
+	progress TableProgress
+	subset   *Subset
+	filters  []TableFilter
+
+	// Consistency of the source read: PostgreSQL SERIALIZABLE DEFERRABLE transaction, MongoDB read
+	// preference and oplog, MySQL binlog position
+	serializableDeferrable bool
+	readPreference         string
+	oplog                  bool
+	sourcePosition         bool
+
+	// Parts of subset and filtered dumps: PostgreSQL section, exported snapshot and tables whose data
+	// is dumped apart, MySQL schema only or table selection, MongoDB collection selection
+	section      string
+	snapshot     string
+	excludeData  []string
+	noData       bool
+	ignoreTables []string
+	tables       []string
+	where        string
+	collection   string
+	archive      string
+}
+
+// WithDataOnly dumps table contents without the statements that recreate the schema
+func WithDataOnly() DumperOption {
+	return func(o *dumpOptions) {
+		o.dataOnly = true
+	}
+}
+
+// WithTableProgress reports the tables and collections the dump tool starts and finishes
+func WithTableProgress(progress TableProgress) DumperOption {
+	return func(o *dumpOptions) {
+		o.progress = progress
+	}
+}
+
+// WithMaskableFormat dumps in a text format the anonymize package can rewrite: plain SQL for
+// PostgreSQL and INSERT statements naming their columns for MySQL
+func WithMaskableFormat() DumperOption {
+	return func(o *dumpOptions) {
+		o.maskable = true
+	}
+}
+
+// WithSubset dumps the schema and the rows of a subset, with every row they reference, instead of
+// the whole database. Only PostgreSQL and MySQL dumpers support subsets; PostgreSQL subsets are plain SQL.
+func WithSubset(subset Subset) DumperOption {
+	return func(o *dumpOptions) {
+		o.subset = &subset
+	}
+}
+
+// WithWhere dumps only the rows of the filtered tables matching their predicate, an SQL condition or
+// a MongoDB query in extended JSON. PostgreSQL filtered dumps are plain SQL.
+func WithWhere(filters []TableFilter) DumperOption {
+	return func(o *dumpOptions) {
+		o.filters = filters
+	}
+}
+
+// WithSerializableDeferrable makes PostgreSQL dumps wait for a snapshot free of serialization anomalies,
+// which no concurrent transaction can invalidate
+func WithSerializableDeferrable() DumperOption {
+	return func(o *dumpOptions) {
+		o.serializableDeferrable = true
+	}
+}
+
+// WithSnapshot makes PostgreSQL dumps read the snapshot exported by another transaction, see
+// ExportPostgresSnapshot
+func WithSnapshot(id string) DumperOption {
+	return func(o *dumpOptions) {
+		o.snapshot = id
+	}
+}
+
+// WithReadPreference sets the MongoDB read preference of the dump, e.g. secondary
+func WithReadPreference(preference string) DumperOption {
+	return func(o *dumpOptions) {
+		o.readPreference = preference
+	}
+}
+
+// WithOplog adds the oplog entries written during a MongoDB dump, for a point-in-time restore with
+// WithOplogReplay. Only full dumps, without database in the connection string, support it.
+func WithOplog() DumperOption {
+	return func(o *dumpOptions) {
+		o.oplog = true
+	}
+}
+
+// WithSourcePosition records the binlog position and GTID set of a MySQL dump, see PositionDumper
+func WithSourcePosition() DumperOption {
+	return func(o *dumpOptions) {
+		o.sourcePosition = true
+	}
+}
+
+func newDumpOptions(opts []DumperOption) dumpOptions {
+	var o dumpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// RestorerOption configures optional behaviour of a Restorer
+type RestorerOption func(*restoreOptions)
+
+type restoreOptions struct {
+	namespaces NamespaceMapping
+	merge      bool
+	plain      bool
+	oplog      bool
+}
+
+// WithNamespaces restricts and renames the restored MongoDB namespaces
+func WithNamespaces(m NamespaceMapping) RestorerOption {
+	return func(o *restoreOptions) {
+		o.namespaces = m
+	}
+}
+
+// WithMerge appends the restored data to the target instead of dropping existing objects first
+func WithMerge() RestorerOption {
+	return func(o *restoreOptions) {
+		o.merge = true
+	}
+}
+
+// WithPlainFormat restores a plain SQL PostgreSQL dump, as written with WithMaskableFormat
+func WithPlainFormat() RestorerOption {
+	return func(o *restoreOptions) {
+		o.plain = true
+	}
+}
+
+// WithOplogReplay replays the oplog of a MongoDB dump written with WithOplog
+func WithOplogReplay() RestorerOption {
+	return func(o *restoreOptions) {
+		o.oplog = true
+	}
+}
+
+func newRestoreOptions(opts []RestorerOption) restoreOptions {
+	var o restoreOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func CreateDumper(dbType string, connStr string, useStdOut bool, opts ...DumperOption) (Dumper, error) {
 	switch DatabaseType(dbType) {
 	case Postgres:
 		// Use custom format when not in stdout mode -- better for large databases
 		// Use plain format when in stdout mode -- better for readability
 		useCustomFormat := !useStdOut
-		return NewPostgresDumper(connStr, useCustomFormat), nil
+		return NewPostgresDumper(connStr, useCustomFormat, opts...), nil
 	case MySQL:
-		return NewMySQLDumper(connStr), nil
+		return NewMySQLDumper(connStr, opts...), nil
 	case MongoDB:
-		return NewMongoDBDumper(connStr), nil
+		options := newDumpOptions(opts)
+		if options.subset != nil {
+			return nil, fmt.Errorf("subset dumps are not supported for MongoDB")
+		}
+		if err := validateMongoQueries(options.filters); err != nil {
+			return nil, err
+		}
+		if options.oplog {
+			// mongodump only records the oplog of full dumps
+			if database, err := DatabaseName(connStr); err != nil || database != "" {
+				return nil, fmt.Errorf("oplog dumps require a MongoDB connection string without database")
+			}
+		}
+		return NewMongoDBDumper(connStr, opts...), nil
 	default:
 		return nil, fmt.Errorf("unsupported source database type: %s", dbType)
 	}
 }
 
-func CreateRestorer(dbType string, connStr string) (Restorer, error) {
+func CreateRestorer(dbType string, connStr string, opts ...RestorerOption) (Restorer, error) {
 	switch DatabaseType(dbType) {
 	case Postgres:
-		return NewPostgresRestorer(connStr), nil
+		return NewPostgresRestorer(connStr, opts...), nil
 	case MySQL:
+		// mysqldump output carries its own DROP/CREATE statements, so merging is handled by the dumper
 		return NewMySQLRestorer(connStr), nil
 	case MongoDB:
-		return NewMongoDBRestorer(connStr), nil
+		return NewMongoDBRestorer(connStr, opts...), nil
 	default:
 		return nil, fmt.Errorf("unsupported target database type: %s", dbType)
 	}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"data-migration/internal/config"
+	"data-migration/internal/metrics"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"time"
 )
 
 // Verifier defines the interface for database verification operations
@@ -19,11 +21,16 @@ type Verifier interface {
 
 const defaultChunkSize = 10 * 1024 * 1024 // 10MB chunks by default
 
+// ErrContentMismatch is returned when the source and target contents differ
+var ErrContentMismatch = errors.New("content verification failed: source and target databases do not match")
+
 // DatabaseVerifier implements verification for any database type
 type DatabaseVerifier struct {
 	sourceDumper Dumper
 	targetDumper Dumper
 	chunkSize    int
+	namespaces   NamespaceMapping
+	logger       *config.Logger
 }
 
 // VerifierOption defines function type for verifier options
@@ -38,6 +45,20 @@ func WithChunkSize(size int) VerifierOption {
 	}
 }
 
+// WithNamespaceMapping compares MongoDB collections through the mapping applied at restore time
+func WithNamespaceMapping(m NamespaceMapping) VerifierOption {
+	return func(v *DatabaseVerifier) {
+		v.namespaces = m
+	}
+}
+
+// WithLogger reports verification progress to logger; nothing is logged by default
+func WithLogger(logger *config.Logger) VerifierOption {
+	return func(v *DatabaseVerifier) {
+		v.logger = logger
+	}
+}
+
 // NewDatabaseVerifier creates a new verifier instance
 func NewDatabaseVerifier(sourceDumper, targetDumper Dumper, opts ...VerifierOption) (*DatabaseVerifier, error) {
 	if sourceDumper == nil || targetDumper == nil {
@@ -52,6 +73,7 @@ func NewDatabaseVerifier(sourceDumper, targetDumper Dumper, opts ...VerifierOpti
 		sourceDumper: sourceDumper,
 		targetDumper: targetDumper,
 		chunkSize:    defaultChunkSize,
+		logger:       config.NewNopLogger(),
 	}
 
 	// Apply options
@@ -64,232 +86,215 @@ func NewDatabaseVerifier(sourceDumper, targetDumper Dumper, opts ...VerifierOpti
 
 // compareReaders compares two io.Reader streams chunk by chunk
 func (v *DatabaseVerifier) compareReaders(ctx context.Context, source, target io.Reader) (bool, error) {
-	fmt.Fprintf(os.Stderr, "DEBUG: compareReaders started\n")
-
 	sourceChunk := make([]byte, v.chunkSize)
 	targetChunk := make([]byte, v.chunkSize)
 
-	chunkCount := 0
-	totalSourceBytes := 0
-	totalTargetBytes := 0
+	progress := newVerifyProgress(v.logger)
+	defer progress.done()
 
 	for {
-		chunkCount++
-		fmt.Fprintf(os.Stderr, "DEBUG: Starting chunk #%d\n", chunkCount)
-
 		select {
 		case <-ctx.Done():
-			fmt.Fprintf(os.Stderr, "DEBUG: Context cancelled in compareReaders\n")
 			return false, ctx.Err()
 		default:
-			// Read chunks from both sources
-			fmt.Fprintf(os.Stderr, "DEBUG: About to read source chunk #%d\n", chunkCount)
-			sourceN, sourceErr := io.ReadFull(source, sourceChunk)
-			fmt.Fprintf(os.Stderr, "DEBUG: Source chunk #%d read: %d bytes, err: %v\n", chunkCount, sourceN, sourceErr)
-			totalSourceBytes += sourceN
-
-			fmt.Fprintf(os.Stderr, "DEBUG: About to read target chunk #%d\n", chunkCount)
-			targetN, targetErr := io.ReadFull(target, targetChunk)
-			fmt.Fprintf(os.Stderr, "DEBUG: Target chunk #%d read: %d bytes, err: %v\n", chunkCount, targetN, targetErr)
-			totalTargetBytes += targetN
-
-			fmt.Fprintf(os.Stderr, "DEBUG: Total bytes so far - Source: %d, Target: %d\n", totalSourceBytes, totalTargetBytes)
-
-			// Handle read results
-			if sourceErr != nil && sourceErr != io.EOF && !errors.Is(sourceErr, io.ErrUnexpectedEOF) {
-				fmt.Fprintf(os.Stderr, "DEBUG: Source read error: %v\n", sourceErr)
-				return false, fmt.Errorf("error reading source: %w", sourceErr)
-			}
-			if targetErr != nil && targetErr != io.EOF && !errors.Is(targetErr, io.ErrUnexpectedEOF) {
-				fmt.Fprintf(os.Stderr, "DEBUG: Target read error: %v\n", targetErr)
-				return false, fmt.Errorf("error reading target: %w", targetErr)
-			}
+		}
 
-			fmt.Fprintf(os.Stderr, "DEBUG: About to compare chunks for database type: %s\n", v.sourceDumper.GetType())
-
-			// Compare chunks based on database type
-			switch v.sourceDumper.GetType() {
-			case Postgres:
-				fmt.Fprintf(os.Stderr, "DEBUG: Normalizing PostgreSQL chunks\n")
-				normalizedSource, err := normalizePostgresDump(sourceChunk[:sourceN])
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "DEBUG: Error normalizing source: %v\n", err)
-					return false, fmt.Errorf("error normalizing source PostgreSQL dump: %w", err)
-				}
-				normalizedTarget, err := normalizePostgresDump(targetChunk[:targetN])
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "DEBUG: Error normalizing target: %v\n", err)
-					return false, fmt.Errorf("error normalizing target PostgreSQL dump: %w", err)
-				}
-				fmt.Fprintf(os.Stderr, "DEBUG: Comparing normalized chunks (source: %d bytes, target: %d bytes)\n", len(normalizedSource), len(normalizedTarget))
-				if !bytes.Equal(normalizedSource, normalizedTarget) {
-					fmt.Fprintf(os.Stderr, "DEBUG: Postgres chunks don't match (source: %d bytes, target: %d bytes)\n", sourceN, targetN)
-					return false, nil
-				}
-				fmt.Fprintf(os.Stderr, "DEBUG: Postgres chunks match\n")
-			case MySQL:
-				fmt.Fprintf(os.Stderr, "DEBUG: Normalizing MySQL chunks\n")
-				normalizedSource, err := normalizeMySQLDump(sourceChunk[:sourceN])
-				if err != nil {
-					return false, err
-				}
-				normalizedTarget, err := normalizeMySQLDump(targetChunk[:targetN])
-				if err != nil {
-					return false, err
-				}
-				if !bytes.Equal(normalizedSource, normalizedTarget) {
-					fmt.Fprintf(os.Stderr, "DEBUG: MySQL chunks don't match\n")
-					return false, nil
-				}
-				fmt.Fprintf(os.Stderr, "DEBUG: MySQL chunks match\n")
-			case MongoDB:
-				fmt.Fprintf(os.Stderr, "DEBUG: Normalizing MongoDB chunks\n")
-				normalizedSource, err := normalizeMongoDBDump(sourceChunk[:sourceN])
-				if err != nil {
-					return false, err
-				}
-				normalizedTarget, err := normalizeMongoDBDump(targetChunk[:targetN])
-				if err != nil {
-					return false, err
-				}
-				if !bytes.Equal(normalizedSource, normalizedTarget) {
-					fmt.Fprintf(os.Stderr, "DEBUG: MongoDB chunks don't match\n")
-					return false, nil
-				}
-				fmt.Fprintf(os.Stderr, "DEBUG: MongoDB chunks match\n")
-			}
+		// Read chunks from both sources
+		sourceN, sourceErr := io.ReadFull(source, sourceChunk)
+		targetN, targetErr := io.ReadFull(target, targetChunk)
 
-			// Check if we've reached the end of both streams
-			if sourceErr == io.EOF || errors.Is(sourceErr, io.ErrUnexpectedEOF) {
-				fmt.Fprintf(os.Stderr, "DEBUG: Source stream ended\n")
-				if targetErr == io.EOF || errors.Is(targetErr, io.ErrUnexpectedEOF) {
-					fmt.Fprintf(os.Stderr, "DEBUG: Target stream ended, comparing final bytes: sourceN=%d, targetN=%d\n", sourceN, targetN)
-					// Both streams ended
-					result := sourceN == targetN
-					fmt.Fprintf(os.Stderr, "DEBUG: Final comparison result: %v\n", result)
-					return result, nil
-				}
-				// Source ended but target didn't
-				fmt.Fprintf(os.Stderr, "DEBUG: Source ended but target didn't - mismatch\n")
-				return false, nil
-			}
-			if targetErr == io.EOF || errors.Is(targetErr, io.ErrUnexpectedEOF) {
-				// Target ended but source didn't
-				fmt.Fprintf(os.Stderr, "DEBUG: Target ended but source didn't - mismatch\n")
+		// Handle read results
+		if sourceErr != nil && sourceErr != io.EOF && !errors.Is(sourceErr, io.ErrUnexpectedEOF) {
+			return false, fmt.Errorf("error reading source: %w", sourceErr)
+		}
+		if targetErr != nil && targetErr != io.EOF && !errors.Is(targetErr, io.ErrUnexpectedEOF) {
+			return false, fmt.Errorf("error reading target: %w", targetErr)
+		}
+
+		equal, err := v.compareChunks(sourceChunk[:sourceN], targetChunk[:targetN])
+		if err != nil {
+			return false, err
+		}
+		metrics.ChunkCompared(sourceN, equal)
+		progress.chunk(sourceN, targetN, equal)
+		if !equal {
+			return false, nil
+		}
+
+		// Check if we've reached the end of both streams
+		sourceEnded := sourceErr == io.EOF || errors.Is(sourceErr, io.ErrUnexpectedEOF)
+		targetEnded := targetErr == io.EOF || errors.Is(targetErr, io.ErrUnexpectedEOF)
+		if sourceEnded || targetEnded {
+			if sourceEnded != targetEnded {
+				v.logger.Debugw("Verification streams ended at different lengths",
+					"source_ended", sourceEnded, "target_ended", targetEnded)
 				return false, nil
 			}
-
-			fmt.Fprintf(os.Stderr, "DEBUG: Chunk #%d processed successfully, continuing to next chunk\n", chunkCount)
+			return sourceN == targetN, nil
 		}
 	}
 }
 
+// compareChunks compares a pair of chunks after normalizing the parts of the dumps expected to differ
+func (v *DatabaseVerifier) compareChunks(source, target []byte) (bool, error) {
+	var normalize func([]byte) ([]byte, error)
+	switch v.sourceDumper.GetType() {
+	case Postgres:
+		normalize = normalizePostgresDump
+	case MySQL:
+		normalize = normalizeMySQLDump
+	case MongoDB:
+		normalize = normalizeMongoDBDump
+	default:
+		return bytes.Equal(source, target), nil
+	}
+
+	normalizedSource, err := normalize(source)
+	if err != nil {
+		return false, fmt.Errorf("error normalizing source %s dump: %w", v.sourceDumper.GetType(), err)
+	}
+	normalizedTarget, err := normalize(target)
+	if err != nil {
+		return false, fmt.Errorf("error normalizing target %s dump: %w", v.targetDumper.GetType(), err)
+	}
+
+	return bytes.Equal(normalizedSource, normalizedTarget), nil
+}
+
 // VerifyContent performs verification of the migration by comparing dumps
-func (v *DatabaseVerifier) VerifyContent(ctx context.Context) error {
-	fmt.Fprintf(os.Stderr, "DEBUG: VerifyContent started\n")
+func (v *DatabaseVerifier) VerifyContent(ctx context.Context) (err error) {
+	defer metrics.StartPhase(metrics.PhaseVerifying)()
+	defer func() {
+		switch {
+		case errors.Is(err, ErrContentMismatch):
+			metrics.RecordError(metrics.ErrorMismatch)
+		case err != nil:
+			metrics.RecordError(metrics.ErrorVerification)
+		}
+	}()
+
+	if !v.namespaces.IsZero() {
+		return v.verifyNamespaces(ctx)
+	}
+
+	return v.verifyStreams(ctx, v.sourceDumper.Dump, v.targetDumper.Dump)
+}
+
+// verifyNamespaces compares every restored source collection with its counterpart on the target
+func (v *DatabaseVerifier) verifyNamespaces(ctx context.Context) error {
+	sourceDumper, ok := v.sourceDumper.(NamespaceDumper)
+	if !ok {
+		return fmt.Errorf("namespace mapping is not supported for %s verification", v.sourceDumper.GetType())
+	}
+	targetDumper, ok := v.targetDumper.(NamespaceDumper)
+	if !ok {
+		return fmt.Errorf("namespace mapping is not supported for %s verification", v.targetDumper.GetType())
+	}
+
+	sourceNamespaces, err := sourceDumper.Namespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list source namespaces: %w", err)
+	}
+	targetNamespaces, err := targetDumper.Namespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list target namespaces: %w", err)
+	}
+
+	existing := make(map[string]bool, len(targetNamespaces))
+	for _, ns := range targetNamespaces {
+		existing[ns] = true
+	}
+
+	for _, sourceNs := range sourceNamespaces {
+		targetNs, ok := v.namespaces.Map(sourceNs)
+		if !ok {
+			v.logger.Debugw("Skipping namespace excluded from restore", "phase", "verifying", "table", sourceNs)
+			continue
+		}
+		if !existing[targetNs] {
+			return fmt.Errorf("%w: namespace %s (from %s) is missing on target", ErrContentMismatch, targetNs, sourceNs)
+		}
+
+		v.logger.Infow("Verifying namespace", "phase", "verifying", "table", sourceNs, "target_table", targetNs)
+		err := v.verifyStreams(ctx,
+			func(ctx context.Context, w io.Writer) error { return sourceDumper.DumpNamespace(ctx, sourceNs, w) },
+			func(ctx context.Context, w io.Writer) error { return targetDumper.DumpNamespace(ctx, targetNs, w) },
+		)
+		if err != nil {
+			return fmt.Errorf("namespace %s: %w", sourceNs, err)
+		}
+	}
 
+	return nil
+}
+
+// verifyStreams runs both dump functions concurrently and compares their output
+func (v *DatabaseVerifier) verifyStreams(ctx context.Context, dumpSource, dumpTarget func(context.Context, io.Writer) error) error {
 	// Create pipes for streaming the dumps
 	sourceReader, sourceWriter := io.Pipe()
 	targetReader, targetWriter := io.Pipe()
-	fmt.Fprintf(os.Stderr, "DEBUG: Pipes created\n")
 
 	// Create error channels for the dump operations
 	sourceDumpErr := make(chan error, 1)
 	targetDumpErr := make(chan error, 1)
 	compareErr := make(chan error, 1)
-	fmt.Fprintf(os.Stderr, "DEBUG: Error channels created\n")
 
 	// Start dumping source database
 	go func() {
-		fmt.Fprintf(os.Stderr, "DEBUG: Source dump goroutine started\n")
-		defer func() {
-			fmt.Fprintf(os.Stderr, "DEBUG: Source dump goroutine closing writer\n")
-			sourceWriter.Close()
-		}()
-		fmt.Fprintf(os.Stderr, "DEBUG: About to call source dumper.Dump()\n")
-		err := v.sourceDumper.Dump(ctx, sourceWriter)
-		fmt.Fprintf(os.Stderr, "DEBUG: Source dumper.Dump() completed with error: %v\n", err)
+		defer sourceWriter.Close()
+		err := dumpSource(ctx, sourceWriter)
+		v.logger.Debugw("Source verification dump finished", "phase", "verifying", "error", err)
 		sourceDumpErr <- err
-		fmt.Fprintf(os.Stderr, "DEBUG: Source dump error sent to channel\n")
 	}()
 
 	// Start dumping target database
 	go func() {
-		fmt.Fprintf(os.Stderr, "DEBUG: Target dump goroutine started\n")
-		defer func() {
-			fmt.Fprintf(os.Stderr, "DEBUG: Target dump goroutine closing writer\n")
-			targetWriter.Close()
-		}()
-		fmt.Fprintf(os.Stderr, "DEBUG: About to call target dumper.Dump()\n")
-		err := v.targetDumper.Dump(ctx, targetWriter)
-		fmt.Fprintf(os.Stderr, "DEBUG: Target dumper.Dump() completed with error: %v\n", err)
+		defer targetWriter.Close()
+		err := dumpTarget(ctx, targetWriter)
+		v.logger.Debugw("Target verification dump finished", "phase", "verifying", "error", err)
 		targetDumpErr <- err
-		fmt.Fprintf(os.Stderr, "DEBUG: Target dump error sent to channel\n")
 	}()
 
 	// Start comparison in a goroutine
 	go func() {
-		fmt.Fprintf(os.Stderr, "DEBUG: Comparison goroutine started\n")
+		// Closing the readers unblocks the dumps when the comparison stops early
+		defer sourceReader.Close()
+		defer targetReader.Close()
+
 		equal, err := v.compareReaders(ctx, sourceReader, targetReader)
-		fmt.Fprintf(os.Stderr, "DEBUG: compareReaders completed: equal=%v, err=%v\n", equal, err)
-		if err != nil {
+		switch {
+		case err != nil:
 			compareErr <- err
-			fmt.Fprintf(os.Stderr, "DEBUG: Comparison error sent to channel: %v\n", err)
-			return
-		}
-		if !equal {
-			compareErr <- fmt.Errorf("content verification failed: source and target databases do not match")
-			fmt.Fprintf(os.Stderr, "DEBUG: Databases don't match error sent to channel\n")
-			return
+		case !equal:
+			compareErr <- ErrContentMismatch
+		default:
+			compareErr <- nil
 		}
-		compareErr <- nil
-		fmt.Fprintf(os.Stderr, "DEBUG: Comparison success sent to channel\n")
 	}()
 
-	// Wait for all operations to complete - corrected logic
+	// Wait for all operations to complete
 	var sourceDumpError, targetDumpError, compareError error
-	completedOperations := 0
-	fmt.Fprintf(os.Stderr, "DEBUG: Starting to wait for operations to complete\n")
-
-	for completedOperations < 3 {
-		fmt.Fprintf(os.Stderr, "DEBUG: Waiting for operation %d/3\n", completedOperations+1)
+	for completedOperations := 0; completedOperations < 3; completedOperations++ {
 		select {
 		case <-ctx.Done():
-			fmt.Fprintf(os.Stderr, "DEBUG: Context cancelled during wait\n")
 			return ctx.Err()
-		case err := <-sourceDumpErr:
-			fmt.Fprintf(os.Stderr, "DEBUG: Received source dump result: %v\n", err)
-			sourceDumpError = err
-			completedOperations++
-		case err := <-targetDumpErr:
-			fmt.Fprintf(os.Stderr, "DEBUG: Received target dump result: %v\n", err)
-			targetDumpError = err
-			completedOperations++
-		case err := <-compareErr:
-			fmt.Fprintf(os.Stderr, "DEBUG: Received comparison result: %v\n", err)
-			compareError = err
-			completedOperations++
+		case sourceDumpError = <-sourceDumpErr:
+		case targetDumpError = <-targetDumpErr:
+		case compareError = <-compareErr:
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "DEBUG: All operations completed, checking errors\n")
-
-	// Check for errors in order of importance
+	// Check for errors in order of importance; a mismatch makes the dumps fail on the closed pipes
+	if errors.Is(compareError, ErrContentMismatch) {
+		return compareError
+	}
 	if sourceDumpError != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: Returning source dump error\n")
 		return fmt.Errorf("failed to dump source database: %w", sourceDumpError)
 	}
 	if targetDumpError != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: Returning target dump error\n")
 		return fmt.Errorf("failed to dump target database: %w", targetDumpError)
 	}
-	if compareError != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: Returning comparison error\n")
-		return compareError
-	}
-
-	fmt.Fprintf(os.Stderr, "DEBUG: VerifyContent completed successfully\n")
-	return nil
+	return compareError
 }
 
 // GetChecksum generates a checksum of the database content using streaming
@@ -320,6 +325,65 @@ func (v *DatabaseVerifier) GetChecksum(ctx context.Context) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// Interval between verification progress entries at info level
+const verifyProgressInterval = 30 * time.Second
+
+// verifyProgress logs the chunks compared by a verification, with their throughput
+type verifyProgress struct {
+	logger       *config.Logger
+	start        time.Time
+	lastReport   time.Time
+	chunks       int
+	sourceBytes  int64
+	targetBytes  int64
+	mismatchSeen bool
+}
+
+func newVerifyProgress(logger *config.Logger) *verifyProgress {
+	now := time.Now()
+	return &verifyProgress{logger: logger, start: now, lastReport: now}
+}
+
+func (p *verifyProgress) chunk(sourceN, targetN int, equal bool) {
+	p.chunks++
+	p.sourceBytes += int64(sourceN)
+	p.targetBytes += int64(targetN)
+	p.mismatchSeen = p.mismatchSeen || !equal
+
+	p.logger.Debugw("Verification chunk compared", "phase", "verifying", "chunk", p.chunks,
+		"source_bytes", sourceN, "target_bytes", targetN, "match", equal)
+
+	if time.Since(p.lastReport) >= verifyProgressInterval {
+		p.lastReport = time.Now()
+		p.logger.Infow("Verification in progress", p.fields()...)
+	}
+}
+
+func (p *verifyProgress) done() {
+	msg := "Verification comparison finished"
+	if p.mismatchSeen {
+		msg = "Verification found a mismatch"
+	}
+	p.logger.Infow(msg, p.fields()...)
+}
+
+func (p *verifyProgress) fields() []interface{} {
+	elapsed := time.Since(p.start)
+	throughput := 0.0
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		throughput = float64(p.sourceBytes) / seconds / (1024 * 1024)
+	}
+
+	return []interface{}{
+		"phase", "verifying",
+		"chunks", p.chunks,
+		"bytes", p.sourceBytes,
+		"target_bytes", p.targetBytes,
+		"elapsed", elapsed.Round(time.Millisecond).String(),
+		"throughput_mib_s", fmt.Sprintf("%.1f", throughput),
+	}
+}
+
 // normalizePostgresDump normalizes a PostgreSQL dump chunk for comparison
 func normalizePostgresDump(chunk []byte) ([]byte, error) {
 	lines := bytes.Split(chunk, []byte("\n"))
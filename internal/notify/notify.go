@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"data-migration/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Run statuses
+const (
+	StatusSucceeded          = "succeeded"
+	StatusVerificationFailed = "verification_failed"
+	StatusError              = "error"
+)
+
+// Verification results
+const (
+	VerificationPassed  = "passed"
+	VerificationFailed  = "failed"
+	VerificationSkipped = "skipped"
+)
+
+// Message templates
+const (
+	TemplateJSON  = "json"
+	TemplateSlack = "slack"
+)
+
+// Result is the outcome of the migration of one database
+type Result struct {
+	Status        string             `json:"status"`
+	Error         string             `json:"error,omitempty"`
+	Source        string             `json:"source"`
+	Target        string             `json:"target,omitempty"`
+	PhaseSeconds  map[string]float64 `json:"phase_seconds"`
+	BytesDumped   int64              `json:"bytes_dumped"`
+	BytesRestored int64              `json:"bytes_restored"`
+	Verification  string             `json:"verification"`
+	Checksum      string             `json:"checksum,omitempty"`
+	// Binlog position and GTID set the dump is consistent with, recorded with --master-data
+	SourcePosition string `json:"source_position,omitempty"`
+	SourceGTIDSet  string `json:"source_gtid_set,omitempty"`
+}
+
+// Payload is the notification sent once a run completes. With --all-databases, the top-level
+// figures are the totals of the per-database results.
+type Payload struct {
+	Result
+	DatabaseType    string    `json:"database_type"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Databases       []Result  `json:"databases,omitempty"`
+}
+
+// Notifier posts payloads to a webhook
+type Notifier struct {
+	url        string
+	template   string
+	retries    int
+	retryDelay time.Duration
+	client     *http.Client
+	logger     *config.Logger
+}
+
+// Option defines function type for notifier options
+type Option func(*Notifier)
+
+// WithTemplate selects the message template: json (default) or slack
+func WithTemplate(template string) Option {
+	return func(n *Notifier) {
+		n.template = template
+	}
+}
+
+// WithRetries sets how many times a failed delivery is retried, waiting 1s, 2s, 4s... between attempts
+func WithRetries(retries int) Option {
+	return func(n *Notifier) {
+		n.retries = retries
+	}
+}
+
+// WithLogger reports failed delivery attempts to logger
+func WithLogger(logger *config.Logger) Option {
+	return func(n *Notifier) {
+		n.logger = logger
+	}
+}
+
+// New creates a notifier posting to the webhook at webhookURL
+func New(webhookURL string, opts ...Option) *Notifier {
+	n := &Notifier{
+		url:        webhookURL,
+		template:   TemplateJSON,
+		retries:    3,
+		retryDelay: time.Second,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     config.NewNopLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+// Send posts payload, retrying network errors, 429 and 5xx responses
+func (n *Notifier) Send(ctx context.Context, payload Payload) error {
+	body, err := n.render(payload)
+	if err != nil {
+		return err
+	}
+
+	delay := n.retryDelay
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.retries {
+			return err
+		}
+
+		n.logger.Warnw("Notification delivery failed, retrying",
+			"attempt", attempt+1, "retry_in", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends one delivery attempt and tells whether a failure is worth retrying
+func (n *Notifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid notification URL: %w", unwrapURLError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "migrationdb")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// Webhook URLs embed their credentials, so the URL is left out of the error
+		return true, fmt.Errorf("failed to send notification to %s: %w", req.URL.Host, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("notification to %s rejected: %s", req.URL.Host, resp.Status)
+	}
+
+	return false, nil
+}
+
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// render encodes payload with the configured template
+func (n *Notifier) render(payload Payload) ([]byte, error) {
+	switch n.template {
+	case TemplateJSON:
+		return json.Marshal(payload)
+	case TemplateSlack:
+		return json.Marshal(map[string]string{"text": slackMessage(payload)})
+	default:
+		return nil, fmt.Errorf("unknown notification template %q: expected json or slack", n.template)
+	}
+}
+
+// slackMessage formats payload as a Slack mrkdwn message, also accepted by Mattermost incoming webhooks
+func slackMessage(p Payload) string {
+	var b strings.Builder
+
+	icon, outcome := ":x:", "failed"
+	switch p.Status {
+	case StatusSucceeded:
+		icon, outcome = ":white_check_mark:", "succeeded"
+	case StatusVerificationFailed:
+		icon, outcome = ":warning:", "failed verification"
+	}
+
+	duration := time.Duration(p.DurationSeconds * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(&b, "%s *MigrationDB %s migration %s* after %v\n", icon, p.DatabaseType, outcome, duration)
+	if p.Target != "" {
+		fmt.Fprintf(&b, "`%s` → `%s`\n", p.Source, p.Target)
+	} else {
+		fmt.Fprintf(&b, "`%s` → stdout\n", p.Source)
+	}
+	fmt.Fprintf(&b, "Moved %s, verification %s", formatBytes(p.BytesDumped), p.Verification)
+	if p.Checksum != "" {
+		fmt.Fprintf(&b, " (checksum `%s`)", p.Checksum)
+	}
+	b.WriteString("\n")
+
+	if phases := formatPhases(p.PhaseSeconds); phases != "" {
+		fmt.Fprintf(&b, "Phases: %s\n", phases)
+	}
+	if p.SourcePosition != "" {
+		fmt.Fprintf(&b, "Source binlog position: `%s`\n", p.SourcePosition)
+	}
+	if p.SourceGTIDSet != "" {
+		fmt.Fprintf(&b, "Source GTID set: `%s`\n", p.SourceGTIDSet)
+	}
+	for _, db := range p.Databases {
+		fmt.Fprintf(&b, "• `%s`: %s", db.Source, db.Status)
+		if db.Error != "" {
+			fmt.Fprintf(&b, " (%s)", db.Error)
+		}
+		b.WriteString("\n")
+	}
+	if p.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", p.Error)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatPhases(phases map[string]float64) string {
+	names := make([]string, 0, len(phases))
+	for name := range phases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		duration := time.Duration(phases[name] * float64(time.Second)).Round(time.Second)
+		parts = append(parts, fmt.Sprintf("%s %v", name, duration))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
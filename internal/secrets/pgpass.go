@@ -0,0 +1,228 @@
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ApplyPostgresService expands the service=<name> parameter of a PostgreSQL connection string
+// using the pg_service.conf files looked up by libpq. Values already in the URL take precedence.
+func ApplyPostgresService(connString string) (string, error) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	query := u.Query()
+	service := query.Get("service")
+	if service == "" {
+		return connString, nil
+	}
+
+	settings, err := lookupPostgresService(service)
+	if err != nil {
+		return "", err
+	}
+	query.Del("service")
+
+	for key, value := range settings {
+		switch key {
+		case "host":
+			if u.Hostname() == "" {
+				u.Host = joinHostPort(value, u.Port())
+			}
+		case "port":
+			if u.Port() == "" {
+				u.Host = joinHostPort(u.Hostname(), value)
+			}
+		case "dbname":
+			if strings.TrimPrefix(u.Path, "/") == "" {
+				u.Path = "/" + value
+			}
+		case "user":
+			if u.User == nil {
+				u.User = url.User(value)
+			}
+		case "password":
+			// Applied below, once the user is known
+		default:
+			if !query.Has(key) {
+				query.Set(key, value)
+			}
+		}
+	}
+
+	if password, ok := settings["password"]; ok && u.User != nil {
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			u.User = url.UserPassword(u.User.Username(), password)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func joinHostPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// lookupPostgresService reads the named section of the first service file defining it
+func lookupPostgresService(name string) (map[string]string, error) {
+	var files []string
+	if path := os.Getenv("PGSERVICEFILE"); path != "" {
+		files = append(files, path)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".pg_service.conf"))
+	}
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "pg_service.conf"))
+	}
+
+	for _, path := range files {
+		settings, err := readServiceSection(path, name)
+		if err != nil {
+			return nil, err
+		}
+		if settings != nil {
+			return settings, nil
+		}
+	}
+
+	return nil, fmt.Errorf("postgres service %q not found in %s", name, strings.Join(files, ", "))
+}
+
+func readServiceSection(path, name string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service file: %w", err)
+	}
+	defer file.Close()
+
+	var settings map[string]string
+	inSection := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if inSection {
+				break
+			}
+			inSection = line[1:len(line)-1] == name
+			if inSection {
+				settings = make(map[string]string)
+			}
+			continue
+		}
+
+		if !inSection {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid line %q in service %q", path, line, name)
+		}
+		settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return settings, scanner.Err()
+}
+
+// LookupPgpass returns the password matching host, port, database and user in the libpq
+// password file (PGPASSFILE or ~/.pgpass). Like libpq, a file readable by group or others is ignored.
+func LookupPgpass(host, port, database, user string) (string, bool, error) {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false, nil
+		}
+		path = filepath.Join(home, ".pgpass")
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read password file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read password file: %w", err)
+	}
+	defer file.Close()
+
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "5432"
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+
+		if matchPgpassField(fields[0], host) && matchPgpassField(fields[1], port) &&
+			matchPgpassField(fields[2], database) && matchPgpassField(fields[3], user) {
+			return fields[4], true, nil
+		}
+	}
+
+	return "", false, scanner.Err()
+}
+
+// splitPgpassLine splits a password file line on unescaped colons, unescaping \: and \\
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var current strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case line[i] == ':' && len(fields) < 4:
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(line[i])
+		}
+	}
+
+	return append(fields, current.String())
+}
+
+func matchPgpassField(pattern, value string) bool {
+	return pattern == "*" || pattern == value
+}
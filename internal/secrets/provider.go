@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Provider resolves a secret reference into its value
+type Provider interface {
+	// Scheme is the prefix selecting the provider in a reference, e.g. "vault" for "vault:secret/db#password"
+	Scheme() string
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver dispatches secret references of the form <scheme>:<ref> to the registered providers
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver for the given providers
+func NewResolver(providers ...Provider) *Resolver {
+	r := &Resolver{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds a provider, replacing any provider with the same scheme
+func (r *Resolver) Register(p Provider) {
+	r.providers[p.Scheme()] = p
+}
+
+// Resolve returns the value of a <scheme>:<ref> secret reference
+func (r *Resolver) Resolve(ctx context.Context, reference string) (string, error) {
+	scheme, ref, ok := strings.Cut(reference, ":")
+	if !ok || ref == "" {
+		return "", fmt.Errorf("invalid secret reference %q: expected <provider>:<reference>", reference)
+	}
+
+	p, ok := r.providers[scheme]
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider %q (available: %s)", scheme, strings.Join(r.schemes(), ", "))
+	}
+
+	value, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%s secret %q: %w", scheme, ref, err)
+	}
+
+	return value, nil
+}
+
+func (r *Resolver) schemes() []string {
+	schemes := make([]string, 0, len(r.providers))
+	for scheme := range r.providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// FileProvider reads secrets from files, e.g. Kubernetes secret volumes
+type FileProvider struct{}
+
+func (FileProvider) Scheme() string {
+	return "file"
+}
+
+// Resolve returns the content of the file at path, without its trailing newline
+func (FileProvider) Resolve(ctx context.Context, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimRight(string(content), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("file is empty")
+	}
+
+	return value, nil
+}
+
+// EnvProvider reads secrets from environment variables
+type EnvProvider struct{}
+
+func (EnvProvider) Scheme() string {
+	return "env"
+}
+
+// Resolve returns the value of the environment variable name
+func (EnvProvider) Resolve(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable is not set")
+	}
+	return value, nil
+}
@@ -0,0 +1,103 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads secrets from the HashiCorp Vault HTTP API, supporting KV v1 and v2 engines.
+// References look like secret/data/app/db#password; the field defaults to "password".
+type VaultProvider struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// NewVaultProvider creates a provider talking to the Vault server at address
+func NewVaultProvider(address, token, namespace string) *VaultProvider {
+	return &VaultProvider{
+		Address:   strings.TrimRight(address, "/"),
+		Token:     token,
+		Namespace: namespace,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *VaultProvider) Scheme() string {
+	return "vault"
+}
+
+// Resolve reads the field of the secret stored at path
+func (p *VaultProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	if p.Address == "" {
+		return "", fmt.Errorf("vault address is not configured (--vault-addr or VAULT_ADDR)")
+	}
+	if p.Token == "" {
+		return "", fmt.Errorf("vault token is not configured (--vault-token-file or VAULT_TOKEN)")
+	}
+
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		field = "password"
+	}
+	path = strings.Trim(path, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Address+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var payload struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data next to data.metadata
+	data := payload.Data
+	if nested, ok := data["data"]; ok {
+		if _, isV2 := data["metadata"]; isV2 {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", fmt.Errorf("invalid vault KV v2 response: %w", err)
+			}
+		}
+	}
+
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found", field)
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeVault serves the secrets of a KV v1 engine mounted at kv and a KV v2 engine mounted at secret
+func fakeVault(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if namespace := r.Header.Get("X-Vault-Namespace"); namespace != "" && namespace != "team" {
+			http.Error(w, `{"errors":["no handler for route"]}`, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/kv/app/db":
+			w.Write([]byte(`{"data":{"password":"v1-secret","port":5432}}`))
+		case "/v1/secret/data/app/db":
+			w.Write([]byte(`{"data":{"data":{"password":"v2-secret","admin":"root-secret"},"metadata":{"version":3}}}`))
+		case "/v1/secret/data/broken":
+			w.Write([]byte(`{"data":`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultProviderResolve(t *testing.T) {
+	server := fakeVault(t)
+
+	tests := []struct {
+		name      string
+		ref       string
+		namespace string
+		want      string
+	}{
+		{name: "kv v1", ref: "kv/app/db", want: "v1-secret"},
+		{name: "kv v2", ref: "secret/data/app/db", want: "v2-secret"},
+		{name: "field", ref: "secret/data/app/db#admin", want: "root-secret"},
+		{name: "empty field", ref: "secret/data/app/db#", want: "v2-secret"},
+		{name: "surrounding slashes", ref: "/kv/app/db/", want: "v1-secret"},
+		{name: "namespace", ref: "kv/app/db", namespace: "team", want: "v1-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewVaultProvider(server.URL+"/", "s.token", tt.namespace)
+			got, err := provider.Resolve(context.Background(), tt.ref)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultProviderResolveErrors(t *testing.T) {
+	server := fakeVault(t)
+
+	tests := []struct {
+		name     string
+		provider *VaultProvider
+		ref      string
+		wantErr  string
+	}{
+		{name: "no address", provider: NewVaultProvider("", "s.token", ""), ref: "kv/app/db", wantErr: "address is not configured"},
+		{name: "no token", provider: NewVaultProvider(server.URL, "", ""), ref: "kv/app/db", wantErr: "token is not configured"},
+		{name: "wrong token", provider: NewVaultProvider(server.URL, "s.wrong", ""), ref: "kv/app/db", wantErr: "403"},
+		{name: "unknown path", provider: NewVaultProvider(server.URL, "s.token", ""), ref: "kv/other", wantErr: "404"},
+		{name: "unknown namespace", provider: NewVaultProvider(server.URL, "s.token", "other"), ref: "kv/app/db", wantErr: "404"},
+		{name: "missing field", provider: NewVaultProvider(server.URL, "s.token", ""), ref: "kv/app/db#user", wantErr: `field "user" not found`},
+		{name: "field not a string", provider: NewVaultProvider(server.URL, "s.token", ""), ref: "kv/app/db#port", wantErr: "not a string"},
+		{name: "invalid response", provider: NewVaultProvider(server.URL, "s.token", ""), ref: "secret/data/broken", wantErr: "invalid vault response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.provider.Resolve(context.Background(), tt.ref)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "s.token") {
+				t.Errorf("error %q leaks the token", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinRate is the lowest limit a Limiter is lowered to, in bytes per second
+const MinRate = 1024
+
+// maxChunk bounds the bytes a Writer writes at once, so that a limit applies smoothly
+const maxChunk = 64 * 1024
+
+var rateUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+}
+
+// ParseRate parses a bandwidth such as "50MB/s", "512KB" or "1048576" into bytes per second. Units are
+// multiples of 1024; "0" and "unlimited" mean no limit.
+func ParseRate(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	if strings.EqualFold(value, "unlimited") {
+		return 0, nil
+	}
+	value = strings.TrimSuffix(strings.ToUpper(value), "/S")
+	value = strings.Replace(value, "IB", "B", 1)
+
+	i := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(value)
+	}
+	unit, ok := rateUnits[strings.TrimSpace(value[i:])]
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if !ok || err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q: expected a rate such as 50MB/s", s)
+	}
+
+	rate := int64(number * float64(unit))
+	if rate > 0 && rate < MinRate {
+		return 0, fmt.Errorf("invalid bandwidth %q: the minimum is 1KB/s", s)
+	}
+	return rate, nil
+}
+
+// FormatRate renders a rate of bytes per second the way ParseRate reads it
+func FormatRate(rate int64) string {
+	switch {
+	case rate <= 0:
+		return "unlimited"
+	case rate%(1<<30) == 0:
+		return fmt.Sprintf("%dGB/s", rate>>30)
+	case rate >= 1<<20:
+		return strconv.FormatFloat(float64(rate)/(1<<20), 'f', -1, 64) + "MB/s"
+	case rate >= 1<<10:
+		return strconv.FormatFloat(float64(rate)/(1<<10), 'f', -1, 64) + "KB/s"
+	default:
+		return fmt.Sprintf("%dB/s", rate)
+	}
+}
+
+// Limiter is a token bucket shared by the streams it limits. Its rate may change while they run.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    int64
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+// NewLimiter returns a limiter of rate bytes per second; a rate of 0 does not limit
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: rate, last: time.Now(), changed: make(chan struct{})}
+}
+
+// Rate returns the current limit in bytes per second, 0 when unlimited
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the limit, waking up the streams waiting for the previous one. Positive rates below
+// MinRate are raised to it.
+func (l *Limiter) SetRate(rate int64) {
+	if rate > 0 && rate < MinRate {
+		rate = MinRate
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = rate
+	if rate == 0 {
+		l.tokens = 0
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Wait blocks until n bytes may go through. Tokens are taken up front, so that a large transfer is paid
+// for by the wait that follows it.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate > 0 {
+		l.refill(time.Now())
+		l.tokens -= float64(n)
+	}
+	l.mu.Unlock()
+
+	for {
+		l.mu.Lock()
+		if l.rate == 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		l.refill(now)
+		if l.tokens >= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// refill adds the tokens earned since the last call, keeping at most a tenth of a second of burst
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if burst := float64(max(l.rate/10, maxChunk)); l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+}
+
+// Writer limits the bytes written to an io.Writer
+type Writer struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *Limiter
+}
+
+// NewWriter returns a writer to w limited by limiter until ctx is done
+func NewWriter(ctx context.Context, w io.Writer, limiter *Limiter) *Writer {
+	return &Writer{ctx: ctx, w: w, limiter: limiter}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxChunk)]
+		if err := w.limiter.Wait(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
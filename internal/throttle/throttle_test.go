@@ -0,0 +1,233 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "0", want: 0},
+		{input: "unlimited", want: 0},
+		{input: "Unlimited", want: 0},
+		{input: "1048576", want: 1 << 20},
+		{input: "512KB", want: 512 << 10},
+		{input: "512k", want: 512 << 10},
+		{input: "50MB/s", want: 50 << 20},
+		{input: "50MiB/s", want: 50 << 20},
+		{input: " 1.5 GB/s ", want: 3 << 29},
+		{input: "1KB/s", want: MinRate},
+		{input: "1023", wantErr: true},
+		{input: "0.5KB", wantErr: true},
+		{input: "-1MB", wantErr: true},
+		{input: "10TB", wantErr: true},
+		{input: "fast", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want string
+	}{
+		{rate: 0, want: "unlimited"},
+		{rate: 512, want: "512B/s"},
+		{rate: 1536, want: "1.5KB/s"},
+		{rate: 50 << 20, want: "50MB/s"},
+		{rate: 3 << 29, want: "1536MB/s"},
+		{rate: 2 << 30, want: "2GB/s"},
+	}
+
+	for _, tt := range tests {
+		got := FormatRate(tt.rate)
+		if got != tt.want {
+			t.Errorf("FormatRate(%d) = %q, want %q", tt.rate, got, tt.want)
+		}
+		if tt.rate >= MinRate {
+			if parsed, err := ParseRate(got); err != nil || parsed != tt.rate {
+				t.Errorf("ParseRate(FormatRate(%d)) = %d, %v", tt.rate, parsed, err)
+			}
+		}
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name    string
+		rate    int64
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{name: "earns the rate", rate: 1 << 20, elapsed: 50 * time.Millisecond, want: 0.05 * (1 << 20)},
+		{name: "repays a debt", rate: 1 << 20, tokens: -(1 << 20), elapsed: 500 * time.Millisecond, want: -(1 << 19)},
+		{name: "burst of a tenth of a second", rate: 10 << 20, elapsed: 10 * time.Second, want: 1 << 20},
+		{name: "burst of a chunk at low rates", rate: 10 << 10, elapsed: 10 * time.Second, want: maxChunk},
+		{name: "unlimited", rate: 0, tokens: 0, elapsed: time.Second, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Limiter{rate: tt.rate, tokens: tt.tokens, last: start}
+			l.refill(start.Add(tt.elapsed))
+			if diff := l.tokens - tt.want; diff > 1 || diff < -1 {
+				t.Errorf("tokens = %f, want %f", l.tokens, tt.want)
+			}
+			if !l.last.Equal(start.Add(tt.elapsed)) {
+				t.Errorf("last refill not recorded")
+			}
+		})
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	const rate = 1 << 20
+	l := NewLimiter(rate)
+
+	// A new limiter has no burst to spend
+	begin := time.Now()
+	if err := l.Wait(context.Background(), rate/5); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("200ms of transfer took %v", elapsed)
+	}
+
+	// Idle time earns a burst of a tenth of a second, no more
+	time.Sleep(300 * time.Millisecond)
+	begin = time.Now()
+	l.Wait(context.Background(), rate/10)
+	if elapsed := time.Since(begin); elapsed > 50*time.Millisecond {
+		t.Errorf("burst within the limit waited %v", elapsed)
+	}
+	// Past the burst, the rate applies again
+	l.Wait(context.Background(), rate/10)
+	if elapsed := time.Since(begin); elapsed < 70*time.Millisecond {
+		t.Errorf("transfer past the burst took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0)
+	begin := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background(), 1<<30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(begin); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited waits took %v", elapsed)
+	}
+}
+
+func TestLimiterSetRate(t *testing.T) {
+	l := NewLimiter(0)
+	l.SetRate(10)
+	if got := l.Rate(); got != MinRate {
+		t.Errorf("Rate() = %d after SetRate(10), want %d", got, MinRate)
+	}
+
+	// A wait of 100s at the minimum rate ends once the limit is lifted
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(context.Background(), 100*MinRate) }()
+	time.Sleep(50 * time.Millisecond)
+	l.SetRate(1 << 30)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not wake up when the rate was raised")
+	}
+
+	l.SetRate(MinRate)
+	go func() { done <- l.Wait(context.Background(), 100*MinRate) }()
+	time.Sleep(50 * time.Millisecond)
+	l.SetRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not wake up when the limit was removed")
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l := NewLimiter(MinRate)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, 100*MinRate); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// chunkRecorder records the size of every write
+type chunkRecorder struct {
+	bytes.Buffer
+	chunks []int
+	fail   error
+}
+
+func (r *chunkRecorder) Write(p []byte) (int, error) {
+	r.chunks = append(r.chunks, len(p))
+	if r.fail != nil {
+		return len(p) / 2, r.fail
+	}
+	return r.Buffer.Write(p)
+}
+
+func TestWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (3*maxChunk+100)/16)
+	out := &chunkRecorder{}
+	w := NewWriter(context.Background(), out, NewLimiter(0))
+
+	n, err := w.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Write() = %d, %v, want %d", n, err, len(data))
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("written data differs")
+	}
+	for _, chunk := range out.chunks {
+		if chunk > maxChunk {
+			t.Errorf("chunk of %d bytes, more than %d", chunk, maxChunk)
+		}
+	}
+	if len(out.chunks) != 4 {
+		t.Errorf("%d chunks, want 4", len(out.chunks))
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	failure := errors.New("disk full")
+	w := NewWriter(context.Background(), &chunkRecorder{fail: failure}, NewLimiter(0))
+	if n, err := w.Write(make([]byte, 100)); !errors.Is(err, failure) || n != 50 {
+		t.Errorf("Write() = %d, %v, want 50, %v", n, err, failure)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = NewWriter(ctx, &chunkRecorder{}, NewLimiter(MinRate))
+	if n, err := w.Write(make([]byte, 10*MinRate)); !errors.Is(err, context.Canceled) || n != 0 {
+		t.Errorf("Write() = %d, %v, want 0, %v", n, err, context.Canceled)
+	}
+}
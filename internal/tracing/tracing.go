@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span exporters
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "data-migration"
+
+// Options configure the exporter set up by Setup
+type Options struct {
+	// Exporter is none, otlp or stdout
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector address, e.g. localhost:4318 or https://collector:4318/v1/traces.
+	// When empty, OTEL_EXPORTER_OTLP_ENDPOINT or the SDK default applies.
+	Endpoint string
+	// Output receives the spans of the stdout exporter
+	Output io.Writer
+	// ServiceVersion is reported as the service.version resource attribute
+	ServiceVersion string
+}
+
+// Setup installs the global tracer provider described by opts. The returned function flushes
+// the pending spans and must be called before the program exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var httpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpointURL(endpointURL(opts.Endpoint)))
+		}
+		exporter, err = otlptracehttp.New(ctx, httpOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(opts.Output), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q: expected none, otlp or stdout", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("migrationdb"),
+		semconv.ServiceVersion(opts.ServiceVersion),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// endpointURL completes the OTLP endpoint: a bare host:port defaults to plain HTTP like a local
+// collector, and a URL without path to the standard /v1/traces path
+func endpointURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	if u, err := url.Parse(endpoint); err == nil && strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+		return u.String()
+	}
+	return endpoint
+}
+
+// Start starts a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it as failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// DBSystem is the attribute naming the database type of a span
+func DBSystem(dbType string) attribute.KeyValue {
+	return attribute.String("db.system", dbType)
+}
+
+// Bytes is the attribute holding the bytes moved by a span
+func Bytes(n int64) attribute.KeyValue {
+	return attribute.Int64("migrationdb.bytes", n)
+}
@@ -0,0 +1,266 @@
+package tunnel
+
+import (
+	"data-migration/internal/config"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Interval between keepalive requests, so that idle forwards survive long dumps
+const keepaliveInterval = 30 * time.Second
+
+// Tunnel forwards connections accepted on a local port to a remote address through an SSH server
+type Tunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+	logger   *config.Logger
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Option configures a Tunnel
+type Option func(*options)
+
+type options struct {
+	keyFile    string
+	knownHosts string
+	timeout    time.Duration
+}
+
+// WithKeyFile authenticates with the private key in path, in addition to the SSH agent
+func WithKeyFile(path string) Option {
+	return func(o *options) {
+		o.keyFile = path
+	}
+}
+
+// WithKnownHosts verifies the server host key against the given known_hosts file
+// instead of ~/.ssh/known_hosts
+func WithKnownHosts(path string) Option {
+	return func(o *options) {
+		o.knownHosts = path
+	}
+}
+
+// Open connects to the SSH server described by spec ([user@]host[:port]) and starts
+// forwarding a random local port to remoteAddr
+func Open(spec, remoteAddr string, logger *config.Logger, opts ...Option) (*Tunnel, error) {
+	o := options{timeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	username, serverAddr, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := authMethods(o.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := hostKeyCallback(o.knownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", serverAddr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         o.timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server %s: %w", serverAddr, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to open local tunnel port: %w", err)
+	}
+
+	t := &Tunnel{
+		client:   client,
+		listener: listener,
+		remote:   remoteAddr,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+
+	t.wg.Add(2)
+	go t.accept()
+	go t.keepalive()
+
+	return t, nil
+}
+
+// LocalAddr returns the local host:port forwarded to the remote address
+func (t *Tunnel) LocalAddr() string {
+	return t.listener.Addr().String()
+}
+
+// Close stops accepting connections and closes the SSH connection, which ends active forwards
+func (t *Tunnel) Close() error {
+	close(t.done)
+	t.listener.Close()
+	err := t.client.Close()
+	t.wg.Wait()
+	return err
+}
+
+func (t *Tunnel) accept() {
+	defer t.wg.Done()
+
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+func (t *Tunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		t.logger.Errorf("SSH tunnel failed to reach %s: %v", t.remote, err)
+		return
+	}
+	defer remote.Close()
+
+	// Closing both ends once either direction finishes unblocks the other copy
+	var once sync.Once
+	closeBoth := func() {
+		local.Close()
+		remote.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(remote, local)
+		once.Do(closeBoth)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(local, remote)
+		once.Do(closeBoth)
+	}()
+	wg.Wait()
+}
+
+func (t *Tunnel) keepalive() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if _, _, err := t.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				t.logger.Warnf("SSH tunnel keepalive failed: %v", err)
+			}
+		}
+	}
+}
+
+// parseSpec splits [user@]host[:port] into the user, defaulting to the current one, and the server address
+func parseSpec(spec string) (string, string, error) {
+	username, host, ok := strings.Cut(spec, "@")
+	if !ok {
+		host = spec
+		current, err := user.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("no user in SSH address %q and the current user is unknown: %w", spec, err)
+		}
+		username = current.Username
+	}
+
+	if host == "" {
+		return "", "", fmt.Errorf("invalid SSH address %q: expected [user@]host[:port]", spec)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+
+	return username, host, nil
+}
+
+// authMethods returns the SSH agent signers, if an agent is running, and the key in keyFile
+func authMethods(keyFile string) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+
+	if keyFile != "" {
+		pem, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, fmt.Errorf("SSH key %s is protected by a passphrase, load it into ssh-agent instead", keyFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH key %s: %w", keyFile, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		agentSigners, err := agent.NewClient(conn).Signers()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+		}
+		signers = append(signers, agentSigners...)
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no SSH key available: pass a key file or start ssh-agent")
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+func hostKeyCallback(knownHostsFile string) (ssh.HostKeyCallback, error) {
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH known hosts: %w", err)
+	}
+	return callback, nil
+}